@@ -0,0 +1,42 @@
+// Package audit carries who is making a request, so that the repository can
+// record it next to every product change.
+package audit
+
+import "context"
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// SystemActor is recorded for changes made outside of a request, such as the
+// scheduled purge.
+const SystemActor = "system"
+
+type Info struct {
+	Actor string
+	// ClaimedActor is an actor the client named without proving it. It is
+	// kept next to Actor for investigations, but never trusted.
+	ClaimedActor string
+	RequestID    string
+}
+
+type contextKey struct{}
+
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the Info stored in ctx, with SystemActor as the actor
+// when there is none.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(contextKey{}).(Info)
+	if info.Actor == "" {
+		info.Actor = SystemActor
+	}
+	return info
+}
@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	if info := FromContext(context.Background()); info.Actor != SystemActor || info.RequestID != "" {
+		t.Errorf("expected the system actor without a request, got %+v", info)
+	}
+
+	ctx := WithInfo(context.Background(), Info{Actor: "alice", RequestID: "abc"})
+	if info := FromContext(ctx); info.Actor != "alice" || info.RequestID != "abc" {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
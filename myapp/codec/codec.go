@@ -0,0 +1,208 @@
+// Package codec encodes responses and decodes requests in the media type a
+// client negotiated. The JSON representation is the reference: the other
+// codecs carry the same document in another syntax.
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned by Encode for a value its media type cannot
+// represent.
+var ErrUnsupported = errors.New("value not supported by the media type")
+
+var errTrailingData = errors.New("unexpected data after the document")
+
+// DecodeError is a malformed request body. Line and Column locate the error,
+// counting from 1, when the syntax of the media type allows it; they are zero
+// otherwise.
+type DecodeError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	msg := strings.TrimPrefix(e.Err.Error(), "json: ")
+	if e.Line == 0 {
+		return msg
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, msg)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// position returns the line and column of the byte at offset in body, the
+// column counting characters.
+func position(body []byte, offset int64) (line, column int) {
+	if offset < 0 {
+		offset = 0
+	} else if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	before := body[:offset]
+	start := bytes.LastIndexByte(before, '\n') + 1
+	return bytes.Count(before, []byte{'\n'}) + 1, utf8.RuneCount(before[start:]) + 1
+}
+
+// Codec writes values in one media type.
+type Codec interface {
+	MediaType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+// Decoder is a Codec that also reads request bodies. Decode reads a body
+// holding exactly one document into v, and rejects the fields v does not
+// have. The errors of a malformed body are *DecodeError.
+type Decoder interface {
+	Codec
+	Decode(r io.Reader, v interface{}) error
+}
+
+// Registry holds the codecs a server offers, in order of preference.
+type Registry struct {
+	codecs []Codec
+}
+
+// NewRegistry returns a registry offering codecs. The first one is the
+// default, used when the client states no preference.
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds c, replacing the codec registered for the same media type.
+func (r *Registry) Register(c Codec) {
+	for i, registered := range r.codecs {
+		if registered.MediaType() == c.MediaType() {
+			r.codecs[i] = c
+			return
+		}
+	}
+	r.codecs = append(r.codecs, c)
+}
+
+// Default returns the preferred codec.
+func (r *Registry) Default() Codec {
+	return r.codecs[0]
+}
+
+// MediaTypes lists the registered media types in order of preference.
+func (r *Registry) MediaTypes() []string {
+	types := make([]string, len(r.codecs))
+	for i, c := range r.codecs {
+		types[i] = c.MediaType()
+	}
+	return types
+}
+
+// DecodedMediaTypes lists the media types of the registered decoders.
+func (r *Registry) DecodedMediaTypes() []string {
+	var types []string
+	for _, c := range r.codecs {
+		if _, ok := c.(Decoder); ok {
+			types = append(types, c.MediaType())
+		}
+	}
+	return types
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept reads the media ranges of an Accept header, skipping the
+// malformed ones.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, quality})
+	}
+	return ranges
+}
+
+// quality is the weight ranges give mediaType, taken from the most specific
+// range that matches it.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	best, specificity := 0.0, -1
+	mainType := mediaType[:strings.IndexByte(mediaType, '/')]
+	for _, mr := range ranges {
+		s := -1
+		switch mr.mediaType {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = mr.quality, s
+		}
+	}
+	return best
+}
+
+// Negotiate returns the codec an Accept header prefers, breaking ties with
+// the order of the registry. It returns the default codec when accept is
+// empty, and nil when no registered media type is acceptable.
+func (r *Registry) Negotiate(accept string) Codec {
+	if strings.TrimSpace(accept) == "" {
+		return r.Default()
+	}
+
+	ranges := parseAccept(accept)
+	candidates := make([]Codec, len(r.codecs))
+	copy(candidates, r.codecs)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return quality(ranges, candidates[i].MediaType()) > quality(ranges, candidates[j].MediaType())
+	})
+	if quality(ranges, candidates[0].MediaType()) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// Decoder returns the decoder for the media type of a Content-Type header.
+// A request without a Content-Type is read with the default codec. It
+// returns nil when no registered decoder reads the media type.
+func (r *Registry) Decoder(contentType string) Decoder {
+	if strings.TrimSpace(contentType) == "" {
+		d, _ := r.Default().(Decoder)
+		return d
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, c := range r.codecs {
+		if d, ok := c.(Decoder); ok && c.MediaType() == mediaType {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func registry() *codec.Registry {
+	return codec.NewRegistry(codec.JSON{}, codec.XML{}, codec.MessagePack{})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/html, application/xml;q=0.9, */*;q=0.1", "application/xml"},
+		{"application/*;q=0.5, application/msgpack", "application/msgpack"},
+		{"application/json;q=0.2, application/xml;q=0.8", "application/xml"},
+		{"application/*, application/json;q=0", "application/xml"},
+		{"application/xml;q=oops, application/msgpack", "application/msgpack"},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		c := registry().Negotiate(tt.accept)
+		var got string
+		if c != nil {
+			got = c.MediaType()
+		}
+		if got != tt.expected {
+			t.Errorf("Accept %q: expected %q, got %q", tt.accept, tt.expected, got)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	r := registry()
+	for contentType, expected := range map[string]string{
+		"":                                "application/json",
+		"application/json; charset=utf-8": "application/json",
+		"application/xml":                 "application/xml",
+		"text/csv":                        "",
+		"not a media type":                "",
+	} {
+		d := r.Decoder(contentType)
+		var got string
+		if d != nil {
+			got = d.MediaType()
+		}
+		if got != expected {
+			t.Errorf("Content-Type %q: expected %q, got %q", contentType, expected, got)
+		}
+	}
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	r := registry()
+	r.Register(codec.JSON{})
+	if got := strings.Join(r.MediaTypes(), ","); got != "application/json,application/xml,application/msgpack" {
+		t.Errorf("expected registering a media type again to replace it, got %s", got)
+	}
+}
+
+var product = models.Product{
+	ID:        7,
+	Name:      `Tea & "biscuits"`,
+	Price:     money.MustParse("2.5", "EUR"),
+	Version:   3,
+	CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	UpdatedAt: time.Date(2024, 5, 2, 10, 30, 0, 0, time.UTC),
+}
+
+func TestXML_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (codec.XML{}).Encode(&buf, []interface{}{product, map[string]string{"two words": "x"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<response><item><id>7</id><name>Tea &amp; &#34;biscuits&#34;</name><price><amount>2.50</amount><currency>EUR</currency></price>` +
+		`<version>3</version><createdAt>2024-05-01T10:00:00Z</createdAt><updatedAt>2024-05-02T10:30:00Z</updatedAt></item>` +
+		`<item><entry key="two words">x</entry></item></response>` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []codec.Decoder{codec.JSON{}, codec.XML{}, codec.MessagePack{}} {
+		var buf bytes.Buffer
+		if err := c.Encode(&buf, []models.Product{product, product}); err != nil {
+			t.Fatalf("%s: unexpected encode error: %v", c.MediaType(), err)
+		}
+		var decoded []models.Product
+		if err := c.Decode(&buf, &decoded); err != nil {
+			t.Fatalf("%s: unexpected decode error: %v", c.MediaType(), err)
+		}
+		if len(decoded) != 2 || decoded[1] != product {
+			t.Errorf("%s: expected the products back, got %+v", c.MediaType(), decoded)
+		}
+	}
+}
+
+func TestXML_DecodeSingleItemList(t *testing.T) {
+	var ids []int64
+	if err := (codec.XML{}).Decode(strings.NewReader(`<request><item> 4 </item></request>`), &ids); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 4 {
+		t.Errorf("expected [4], got %v", ids)
+	}
+
+	var p models.Product
+	err := (codec.XML{}).Decode(strings.NewReader(`<product><name>Tea</name><version>three</version></product>`), &p)
+	if err == nil {
+		t.Error("expected an error for a version that is not a number")
+	}
+}
+
+func TestMessagePack_Numbers(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (codec.MessagePack{}).Encode(&buf, map[string]float64{"int": 3, "float": 2.5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := decoded["int"].(int64); !ok {
+		t.Errorf("expected a whole number to be written as an integer, got %T", decoded["int"])
+	}
+	if decoded["float"] != 2.5 {
+		t.Errorf("expected 2.5, got %v", decoded["float"])
+	}
+}
+
+func TestDecode_Strict(t *testing.T) {
+	var trailing bytes.Buffer
+	(codec.MessagePack{}).Encode(&trailing, map[string]string{"name": "Tea"})
+	trailing.WriteByte(0x01)
+
+	tests := []struct {
+		name     string
+		decoder  codec.Decoder
+		body     string
+		expected string
+	}{
+		{"JSONSyntax", codec.JSON{}, "{\"name\":\"Tea\",\n  \"price\": }", "line 2, column 12: invalid character '}' looking for beginning of value"},
+		{"JSONTrailing", codec.JSON{}, `{"name":"Tea"} {"name":"Milk"}`, "line 1, column 16: invalid character '{' after top-level value"},
+		{"JSONUnknownField", codec.JSON{}, "{\n  \"name\": \"Tea\",\n  \"colour\": \"red\"}", `line 3, column 3: unknown field "colour"`},
+		{"JSONType", codec.JSON{}, `{"name":"Tea","version":"3"}`, `line 1, column 27: unexpected string for field "version"`},
+		{"JSONEmpty", codec.JSON{}, ``, "line 1, column 1: unexpected end of JSON input"},
+		{"XMLUnknownField", codec.XML{}, `<product><name>Tea</name><colour>red</colour></product>`, `unknown field "colour"`},
+		{"XMLTrailing", codec.XML{}, `<product><name>Tea</name></product><product/>`, "line 1, column 36: unexpected data after the document"},
+		{"MessagePackTrailing", codec.MessagePack{}, trailing.String(), "unexpected data after the document"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p models.Product
+			err := tt.decoder.Decode(strings.NewReader(tt.body), &p)
+			var decodeErr *codec.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected a DecodeError, got %v", err)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestDecode_KeepsMoneyErrors(t *testing.T) {
+	var p models.Product
+	err := (codec.JSON{}).Decode(strings.NewReader(`{"price":{"amount":"1e3","currency":"EUR"}}`), &p)
+	if !errors.Is(err, money.ErrInvalid) {
+		t.Errorf("expected money.ErrInvalid, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSON is the application/json codec.
+type JSON struct{}
+
+func (JSON) MediaType() string { return "application/json" }
+
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSON) Decode(r io.Reader, v interface{}) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// Unmarshal checks the syntax of the whole body, trailing data included,
+	// and tells where it breaks; the decoder then rejects unknown fields
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal(body, new(json.RawMessage)); errors.As(err, &syntaxErr) {
+		// the offset counts the invalid byte, or the whole body when it ends
+		// too soon
+		offset := syntaxErr.Offset - 1
+		if syntaxErr.Offset >= int64(len(body)) && strings.HasPrefix(err.Error(), "unexpected end") {
+			offset = syntaxErr.Offset
+		}
+		line, column := position(body, offset)
+		return &DecodeError{Line: line, Column: column, Err: err}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			line, column := position(body, typeErr.Offset-1)
+			return &DecodeError{Line: line, Column: column, Err: typeError(typeErr)}
+		}
+		if offset := unknownFieldOffset(body, err); offset >= 0 {
+			line, column := position(body, offset)
+			return &DecodeError{Line: line, Column: column, Err: err}
+		}
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// unknownFieldOffset returns the offset of the first key named like the
+// unknown field of err, or -1. The decoder does not tell where the field is.
+func unknownFieldOffset(body []byte, err error) int64 {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return -1
+	}
+	name, uerr := strconv.Unquote(quoted)
+	if uerr != nil {
+		return -1
+	}
+	key, _ := json.Marshal(name)
+	loc := regexp.MustCompile(regexp.QuoteMeta(string(key)) + `\s*:`).FindIndex(body)
+	if loc == nil {
+		return -1
+	}
+	return int64(loc[0])
+}
+
+// typeError rewords err without the Go names of the field and type.
+func typeError(err *json.UnmarshalTypeError) error {
+	if err.Field == "" {
+		return fmt.Errorf("unexpected %s for the document", err.Value)
+	}
+	return fmt.Errorf("unexpected %s for field %q", err.Value, err.Field)
+}
+
+// document returns the JSON representation of v as plain values: maps,
+// slices, strings, booleans, nil and json.Number.
+func document(v interface{}) (interface{}, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fromDocument stores a document of plain values into v, as if it had been
+// read from JSON. Like JSON.Decode, it rejects unknown fields.
+func fromDocument(doc interface{}, v interface{}) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			err = typeError(typeErr)
+		}
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
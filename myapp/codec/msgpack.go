@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack is the application/msgpack codec. It writes the JSON
+// representation of a value, with integers and floats kept apart.
+type MessagePack struct{}
+
+func (MessagePack) MediaType() string { return "application/msgpack" }
+
+func (MessagePack) Encode(w io.Writer, v interface{}) error {
+	doc, err := document(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(numbers(doc))
+}
+
+func (MessagePack) Decode(r io.Reader, v interface{}) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	rd := bytes.NewReader(body)
+	var doc interface{}
+	if err := msgpack.NewDecoder(rd).Decode(&doc); err != nil {
+		return &DecodeError{Err: err}
+	}
+	if rd.Len() > 0 {
+		return &DecodeError{Err: errTrailingData}
+	}
+	return fromDocument(doc, v)
+}
+
+// numbers replaces the json.Number values of doc with int64 or float64.
+func numbers(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = numbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = numbers(value)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return doc
+}
@@ -0,0 +1,250 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// XML is the application/xml codec. It writes the JSON representation of a
+// value as elements: an object member becomes an element named after its
+// key, an array item an <item> element, and null values are left out. The
+// document element is <response>.
+//
+// XML carries no types, so Decode reads text into the type of the field it
+// is decoded into.
+type XML struct{}
+
+func (XML) MediaType() string { return "application/xml" }
+
+func (XML) Encode(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	// the JSON is read token by token to keep the order of the members
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, dec, "response"); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// xmlName reports whether name can be an element name as is. Other keys are
+// written as <entry key="...">.
+func xmlName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || !(c == '-' || c == '.' || (c >= '0' && c <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeXML writes the next JSON value of dec as an element called name.
+func encodeXML(enc *xml.Encoder, dec *json.Decoder, name string) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return enc.EncodeElement(fmt.Sprint(tok), start)
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for dec.More() {
+		child := "item"
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			child = key.(string)
+		}
+		if err := encodeXML(enc, dec, child); err != nil {
+			return err
+		}
+	}
+	// the closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlNode is an element read from a request.
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+}
+
+func (XML) Decode(r io.Reader, v interface{}) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	fail := func(err error) error {
+		line, column := dec.InputPos()
+		return &DecodeError{Line: line, Column: column, Err: err}
+	}
+	var stack []*xmlNode
+	var root *xmlNode
+	for root == nil {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return fail(io.ErrUnexpectedEOF)
+		} else if err != nil {
+			return fail(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: tok.Name.Local}
+			for _, attr := range tok.Attr {
+				if node.name == "entry" && attr.Name.Local == "key" {
+					node.name = attr.Value
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		case xml.EndElement:
+			if len(stack) == 1 {
+				root = stack[0]
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	// only blank text, comments and processing instructions may follow
+	for {
+		line, column := dec.InputPos()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+		trailing := true
+		switch tok := tok.(type) {
+		case xml.CharData:
+			trailing = len(bytes.TrimSpace(tok)) > 0
+		case xml.Comment, xml.ProcInst:
+			trailing = false
+		}
+		if trailing {
+			return &DecodeError{Line: line, Column: column, Err: errTrailingData}
+		}
+	}
+
+	return fromDocument(nodeValue(root, reflect.TypeOf(v)), v)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// nodeValue converts n to the plain value JSON would hold for a value of
+// type t. A nil t, for a field that does not exist or decodes itself, reads
+// every leaf as a string.
+func nodeValue(n *xmlNode, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && reflect.PointerTo(t).Implements(unmarshalerType) {
+		if len(n.children) == 0 {
+			return n.text
+		}
+		t = nil
+	}
+
+	if len(n.children) == 0 && t != nil {
+		switch t.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			return json.RawMessage(strings.TrimSpace(n.text))
+		case reflect.Slice, reflect.Array:
+			return []interface{}{}
+		case reflect.Struct, reflect.Map:
+			return map[string]interface{}{}
+		}
+	}
+	if len(n.children) == 0 {
+		return n.text
+	}
+
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		items := make([]interface{}, len(n.children))
+		for i, child := range n.children {
+			items[i] = nodeValue(child, t.Elem())
+		}
+		return items
+	}
+
+	obj := make(map[string]interface{}, len(n.children))
+	for _, child := range n.children {
+		var childType reflect.Type
+		if t != nil && t.Kind() == reflect.Map {
+			childType = t.Elem()
+		} else if t != nil && t.Kind() == reflect.Struct {
+			childType = fieldType(t, child.name)
+		}
+		obj[child.name] = nodeValue(child, childType)
+	}
+	return obj
+}
+
+// fieldType returns the type of the field of t that encoding/json matches
+// with key, or nil.
+func fieldType(t reflect.Type, key string) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f.Type
+		}
+	}
+	return nil
+}
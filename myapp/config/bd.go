@@ -1,18 +1,33 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 
 	_ "github.com/lib/pq"
 )
 
-func OpenConn() (*sql.DB, error) {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=admin password=admin dbname=products sslmode=disable")
-
+func OpenConn(cfg DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("could not open database: %w", err)
 	}
 
-	err = db.Ping()
-	return db, err
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx := context.Background()
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not reach database at %s: %w", RedactDSN(cfg.DSN), err)
+	}
+	return db, nil
 }
@@ -0,0 +1,320 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes every environment variable read by Load.
+const EnvPrefix = "MYAPP_"
+
+type Config struct {
+	// Storage selects the product repository: postgres or memory.
+	Storage  string         `yaml:"storage"`
+	Database DatabaseConfig `yaml:"database"`
+	Server   ServerConfig   `yaml:"server"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Proxy    ProxyConfig    `yaml:"proxy"`
+	Purge    PurgeConfig    `yaml:"purge"`
+	// Idempotency configures the Idempotency-Key header of product creation.
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+}
+
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+	QueryTimeout    time.Duration `yaml:"query_timeout"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ImportTimeout replaces the read and write timeouts and the database
+	// query timeout for POST /products/import, from reading the body to
+	// writing the report. Zero leaves imports to the other timeouts.
+	ImportTimeout time.Duration `yaml:"import_timeout"`
+	// BulkTimeout does the same for the /products/bulk requests.
+	BulkTimeout time.Duration `yaml:"bulk_timeout"`
+	// ExportTimeout replaces the write timeout for GET /products/export,
+	// and ends the export and its database transaction when a client reads
+	// too slowly. Zero leaves exports to the write timeout.
+	ExportTimeout time.Duration `yaml:"export_timeout"`
+	TLS           TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+type AdminConfig struct {
+	// Token authorizes admin requests sent with "Authorization: Bearer <token>".
+	// Admin requests are refused while it is empty.
+	Token string `yaml:"token"`
+}
+
+// ProxyConfig authenticates the proxy in front of the API, which names the
+// user of every request in X-Actor.
+type ProxyConfig struct {
+	// Token must be sent in X-Proxy-Token for X-Actor to be trusted. X-Actor
+	// is never trusted while it is empty.
+	Token string `yaml:"token"`
+}
+
+// PurgeConfig schedules the removal of deleted products.
+type PurgeConfig struct {
+	// Retention is how long a deleted product can still be restored.
+	Retention time.Duration `yaml:"retention"`
+	// Interval between two purges. Zero disables purging.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// IdempotencyConfig sets how long the responses of requests sent with an
+// Idempotency-Key are kept for retries.
+type IdempotencyConfig struct {
+	// TTL is how long a key is remembered. Zero ignores the header.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Default returns the configuration used for local development against the
+// database started by docker-compose.yml.
+func Default() Config {
+	return Config{
+		Storage: "postgres",
+		Database: DatabaseConfig{
+			DSN:             "host=localhost port=5432 user=admin password=admin dbname=products sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnectTimeout:  5 * time.Second,
+			QueryTimeout:    5 * time.Second,
+			AutoMigrate:     true,
+		},
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 15 * time.Second,
+			ImportTimeout:   5 * time.Minute,
+			BulkTimeout:     time.Minute,
+			ExportTimeout:   10 * time.Minute,
+		},
+		Purge: PurgeConfig{
+			Retention: 30 * 24 * time.Hour,
+			Interval:  time.Hour,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, then the YAML file at
+// path when it is not empty, then the MYAPP_* environment variables. It does
+// not validate the result, so that callers can apply their own overrides,
+// such as command-line flags, before calling Validate.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(content, &cfg); err != nil {
+			return Config{}, fmt.Errorf("could not parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = v
+		}
+	}
+	integer := func(name string, dst *int) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %q is not an integer", EnvPrefix, name, v))
+			}
+			*dst = n
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %q is not a duration", EnvPrefix, name, v))
+			}
+			*dst = d
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %q is not a boolean", EnvPrefix, name, v))
+			}
+			*dst = b
+		}
+	}
+
+	str("STORAGE", &c.Storage)
+
+	str("DB_DSN", &c.Database.DSN)
+	integer("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	duration("DB_CONNECT_TIMEOUT", &c.Database.ConnectTimeout)
+	duration("DB_QUERY_TIMEOUT", &c.Database.QueryTimeout)
+	boolean("DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+
+	str("HTTP_ADDR", &c.Server.Addr)
+	duration("HTTP_READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("HTTP_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("HTTP_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	duration("HTTP_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	duration("HTTP_IMPORT_TIMEOUT", &c.Server.ImportTimeout)
+	duration("HTTP_BULK_TIMEOUT", &c.Server.BulkTimeout)
+	duration("HTTP_EXPORT_TIMEOUT", &c.Server.ExportTimeout)
+	str("TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+
+	str("ADMIN_TOKEN", &c.Admin.Token)
+	str("PROXY_TOKEN", &c.Proxy.Token)
+
+	duration("PURGE_RETENTION", &c.Purge.Retention)
+	duration("PURGE_INTERVAL", &c.Purge.Interval)
+
+	duration("IDEMPOTENCY_TTL", &c.Idempotency.TTL)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case "postgres":
+		if c.Database.DSN == "" {
+			errs = append(errs, errors.New("database.dsn is required for postgres storage"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("storage must be postgres or memory, got %q", c.Storage))
+	}
+
+	if c.Database.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("database.max_open_conns must not be negative"))
+	}
+	if c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database.max_idle_conns must not be negative"))
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns must not exceed database.max_open_conns"))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls.cert_file and server.tls.key_file must be set together"))
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"database.conn_max_lifetime", c.Database.ConnMaxLifetime},
+		{"database.connect_timeout", c.Database.ConnectTimeout},
+		{"database.query_timeout", c.Database.QueryTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"server.import_timeout", c.Server.ImportTimeout},
+		{"server.bulk_timeout", c.Server.BulkTimeout},
+		{"server.export_timeout", c.Server.ExportTimeout},
+		{"purge.retention", c.Purge.Retention},
+		{"purge.interval", c.Purge.Interval},
+		{"idempotency.ttl", c.Idempotency.TTL},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", d.name))
+		}
+	}
+
+	if c.Purge.Interval > 0 && c.Purge.Retention == 0 {
+		errs = append(errs, errors.New("purge.retention is required when purge.interval is set"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of c that is safe to log.
+func (c Config) Redacted() Config {
+	c.Database.DSN = RedactDSN(c.Database.DSN)
+	if c.Admin.Token != "" {
+		c.Admin.Token = "xxxxx"
+	}
+	if c.Proxy.Token != "" {
+		c.Proxy.Token = "xxxxx"
+	}
+	return c
+}
+
+func (c Config) String() string {
+	// plain drops the String method so that Sprintf does not recurse
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(\\.|[^'])*'|\S+)`)
+
+// RedactDSN hides the password of a URL or key=value connection string.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
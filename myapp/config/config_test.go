@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestDefault_IsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("expected default configuration to be valid, got %v", err)
+	}
+}
+
+func TestLoad_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+storage: memory
+database:
+  query_timeout: 2s
+server:
+  addr: ":9090"
+  tls:
+    cert_file: cert.pem
+    key_file: key.pem
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Storage != "memory" || cfg.Server.Addr != ":9090" || cfg.Database.QueryTimeout != 2*time.Second {
+		t.Errorf("file settings were not applied: %v", cfg)
+	}
+	if !cfg.Server.TLS.Enabled() {
+		t.Errorf("expected TLS to be enabled")
+	}
+	// settings missing from the file keep their defaults
+	if cfg.Database.MaxOpenConns != Default().Database.MaxOpenConns {
+		t.Errorf("expected default max_open_conns, got %d", cfg.Database.MaxOpenConns)
+	}
+}
+
+func TestLoad_LeavesValidationToCaller(t *testing.T) {
+	t.Setenv("MYAPP_STORAGE", "bogus")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("expected Load not to validate, got %v", err)
+	}
+	if cfg.Validate() == nil {
+		t.Errorf("expected the loaded configuration to be invalid")
+	}
+	// an override, like the -storage flag, can still fix it
+	cfg.Storage = "memory"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error after the override: %v", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	err := cfg.applyEnv(env(map[string]string{
+		"MYAPP_DB_DSN":              "postgres://app:secret@db:5432/products",
+		"MYAPP_DB_MAX_OPEN_CONNS":   "50",
+		"MYAPP_DB_AUTO_MIGRATE":     "false",
+		"MYAPP_HTTP_ADDR":           ":9000",
+		"MYAPP_HTTP_READ_TIMEOUT":   "3s",
+		"MYAPP_HTTP_IMPORT_TIMEOUT": "10m",
+		"MYAPP_HTTP_BULK_TIMEOUT":   "2m",
+		"MYAPP_HTTP_EXPORT_TIMEOUT": "20m",
+		"MYAPP_ADMIN_TOKEN":         "token",
+		"MYAPP_PROXY_TOKEN":         "proxy",
+		"MYAPP_PURGE_RETENTION":     "168h",
+		"MYAPP_IDEMPOTENCY_TTL":     "1h",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Database.DSN != "postgres://app:secret@db:5432/products" || cfg.Database.MaxOpenConns != 50 ||
+		cfg.Database.AutoMigrate || cfg.Server.Addr != ":9000" || cfg.Server.ReadTimeout != 3*time.Second || cfg.Server.ImportTimeout != 10*time.Minute || cfg.Server.BulkTimeout != 2*time.Minute || cfg.Server.ExportTimeout != 20*time.Minute ||
+		cfg.Admin.Token != "token" || cfg.Proxy.Token != "proxy" || cfg.Purge.Retention != 7*24*time.Hour || cfg.Idempotency.TTL != time.Hour {
+		t.Errorf("environment was not applied: %v", cfg)
+	}
+}
+
+func TestApplyEnv_Invalid(t *testing.T) {
+	cfg := Default()
+	err := cfg.applyEnv(env(map[string]string{
+		"MYAPP_DB_MAX_OPEN_CONNS": "many",
+		"MYAPP_HTTP_READ_TIMEOUT": "soon",
+	}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range []string{"MYAPP_DB_MAX_OPEN_CONNS", "MYAPP_HTTP_READ_TIMEOUT"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to mention %s, got %v", name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Storage = "mongo"
+	cfg.Database.MaxIdleConns = 100
+	cfg.Server.Addr = ""
+	cfg.Server.TLS.CertFile = "cert.pem"
+	cfg.Server.ShutdownTimeout = -time.Second
+	cfg.Purge.Retention = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, setting := range []string{"storage", "max_idle_conns", "server.addr", "server.tls", "server.shutdown_timeout", "purge.retention"} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("expected error to mention %s, got %v", setting, err)
+		}
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := map[string]string{
+		"host=localhost user=admin password=admin dbname=products": "host=localhost user=admin password=xxxxx dbname=products",
+		"host=localhost password='a b' sslmode=disable":            "host=localhost password=xxxxx sslmode=disable",
+		"postgres://app:secret@db:5432/products":                   "postgres://app:xxxxx@db:5432/products",
+		"postgres://db/products?password=secret":                   "postgres://db/products?password=xxxxx",
+	}
+
+	for dsn, expected := range tests {
+		if got := RedactDSN(dsn); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestString_RedactsSecrets(t *testing.T) {
+	if s := Default().String(); strings.Contains(s, "password=admin") {
+		t.Errorf("expected password to be redacted, got %s", s)
+	}
+
+	cfg := Default()
+	cfg.Admin.Token = "s3cret-token"
+	cfg.Proxy.Token = "proxy-token"
+	if s := cfg.String(); strings.Contains(s, "s3cret-token") || strings.Contains(s, "proxy-token") {
+		t.Errorf("expected tokens to be redacted, got %s", s)
+	}
+}
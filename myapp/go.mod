@@ -5,3 +5,9 @@ go 1.20
 require github.com/gorilla/mux v1.8.1
 
 require github.com/lib/pq v1.10.9
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/vmihailenco/msgpack/v5 v5.4.1
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// isAdmin reports whether r carries the admin token. Nobody is admin while no
+// token is configured.
+func (h *ProductHandler) isAdmin(r *http.Request) bool {
+	token, ok := bearerToken(r)
+	return ok && h.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) == 1
+}
+
+// isProxy reports whether r comes from the authenticating proxy, which sends
+// the proxy token in ProxyTokenHeader. Nothing is while no token is
+// configured.
+func (h *ProductHandler) isProxy(r *http.Request) bool {
+	token := r.Header.Get(ProxyTokenHeader)
+	return token != "" && h.ProxyToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.ProxyToken)) == 1
+}
+
+// requireAdmin answers 401 or 403 and returns false unless r carries the
+// admin token.
+func (h *ProductHandler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := bearerToken(r); !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		Problem(w, http.StatusUnauthorized, CodeAdminTokenRequired, "Admin token required")
+		return false
+	}
+	if !h.isAdmin(r) {
+		Problem(w, http.StatusForbidden, CodeAdminTokenInvalid, "Admin token is not valid")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/bda-mota/MyFirstCRUD/myapp/validate"
+)
+
+// MaxBulkItems caps the number of items of a bulk request.
+const MaxBulkItems = 1000
+
+// maxBulkSize caps the size of a bulk request body.
+const maxBulkSize = 8 << 20
+
+// decodeBulk reads the mode and the items of a bulk request. It answers the
+// request and returns false when they are invalid.
+func decodeBulk[T any](w http.ResponseWriter, r *http.Request) (items []T, atomic bool, ok bool) {
+	query := r.URL.Query()
+	if err := checkParameters(query, bulkParameters); err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return nil, false, false
+	}
+	atomic, err := parseBulkMode(query)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return nil, false, false
+	}
+
+	if !decodeBody(w, r, &items, maxBulkSize) {
+		return nil, false, false
+	}
+	switch {
+	case len(items) == 0:
+		Problem(w, http.StatusBadRequest, CodeMalformedBody, "A bulk request needs at least one item")
+		return nil, false, false
+	case len(items) > MaxBulkItems:
+		Problem(w, http.StatusRequestEntityTooLarge, CodeTooManyItems, fmt.Sprintf("A bulk request accepts at most %d items", MaxBulkItems))
+		return nil, false, false
+	}
+	return items, atomic, true
+}
+
+// runBulk validates items, applies the valid ones and writes the report. An
+// atomic request fails as a whole, with the status of its failing item.
+func runBulk[T any](w http.ResponseWriter, r *http.Request, items []T, atomic bool, validate func(T) error,
+	apply func(ctx context.Context, items []T, atomic bool) ([]repository.BatchResult, error), message string) {
+	report := models.BulkReport{Atomic: atomic, Results: make([]models.BulkResult, len(items))}
+
+	// index maps the position of an item sent to the repository back to its
+	// position in the request
+	var valid []T
+	var index []int
+	for i, item := range items {
+		report.Results[i].Index = i
+		if err := validate(item); err != nil {
+			if atomic {
+				validationProblem(w, http.StatusBadRequest, itemDetail(i, err.Error()), err, fmt.Sprintf("/%d", i))
+				return
+			}
+			report.Results[i].Status, report.Results[i].Code, report.Results[i].Error = http.StatusBadRequest, CodeValidationFailed, err.Error()
+			continue
+		}
+		valid = append(valid, item)
+		index = append(index, i)
+	}
+
+	if len(valid) > 0 {
+		results, err := apply(r.Context(), valid, atomic)
+		var batchErr *repository.BatchError
+		if errors.As(err, &batchErr) {
+			status, code, detail := repositoryProblem(batchErr.Err, message)
+			Problem(w, status, code, itemDetail(index[batchErr.Index], detail))
+			return
+		} else if err != nil {
+			RepositoryError(w, err, message)
+			return
+		}
+
+		for j, res := range results {
+			result := &report.Results[index[j]]
+			result.ID = res.ID
+			if res.Err != nil {
+				result.Status, result.Code, result.Error = repositoryProblem(res.Err, message)
+			} else {
+				result.Status = http.StatusOK
+			}
+		}
+	}
+
+	for _, res := range report.Results {
+		if res.Error != "" {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	respond(w, status, report)
+}
+
+func validateBulkUpdate(p models.Product) error {
+	var errs validate.Errors
+	if p.ID < 1 {
+		errs = append(errs, validate.Error{Field: "/id", Code: "required", Message: "ID is required"})
+	}
+	if err := validateProduct(p); err != nil {
+		errs = append(errs, err.(validate.Errors)...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateBulkDelete(id int64) error {
+	if id < 1 {
+		return validate.Errors{{Code: "not_positive", Message: "ID must be a positive integer"}}
+	}
+	return nil
+}
+
+// BULK POST
+func (h *ProductHandler) BulkCreateProducts(w http.ResponseWriter, r *http.Request) {
+	r, cancel := extendTimeout(w, r, h.BulkTimeout)
+	defer cancel()
+	products, atomic, ok := decodeBulk[models.Product](w, r)
+	if !ok {
+		return
+	}
+	runBulk(w, r, products, atomic, validateProduct, h.Repo.InsertProducts, "could not create products")
+}
+
+// BULK PUT
+func (h *ProductHandler) BulkUpdateProducts(w http.ResponseWriter, r *http.Request) {
+	r, cancel := extendTimeout(w, r, h.BulkTimeout)
+	defer cancel()
+	products, atomic, ok := decodeBulk[models.Product](w, r)
+	if !ok {
+		return
+	}
+	runBulk(w, r, products, atomic, validateBulkUpdate, h.Repo.UpdateProducts, "could not update products")
+}
+
+// BULK DELETE
+func (h *ProductHandler) BulkDeleteProducts(w http.ResponseWriter, r *http.Request) {
+	r, cancel := extendTimeout(w, r, h.BulkTimeout)
+	defer cancel()
+	ids, atomic, ok := decodeBulk[int64](w, r)
+	if !ok {
+		return
+	}
+	runBulk(w, r, ids, atomic, validateBulkDelete, h.Repo.DeleteProducts, "could not delete products")
+}
@@ -0,0 +1,252 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func decodeReport(t *testing.T, body *bytes.Buffer) models.BulkReport {
+	t.Helper()
+
+	var report models.BulkReport
+	if err := json.NewDecoder(body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	return report
+}
+
+func TestBulkCreate_Atomic(t *testing.T) {
+	var received []models.Product
+	var receivedAtomic bool
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			received, receivedAtomic = products, atomic
+			return []repository.BatchResult{{ID: 1}, {ID: 2}}, nil
+		},
+	}
+
+	body := `[{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"name":"Coffee","price":{"amount":"3","currency":"EUR"}}]`
+	req, _ := http.NewRequest("POST", "/products/bulk", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	if len(received) != 2 || !receivedAtomic {
+		t.Errorf("expected an atomic batch of 2 products, got %v (atomic %v)", received, receivedAtomic)
+	}
+	report := decodeReport(t, rr.Body)
+	if !report.Atomic || report.Succeeded != 2 || report.Failed != 0 || report.Results[1].ID != 2 || report.Results[1].Status != http.StatusOK {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestBulkCreate_AtomicInvalidItem(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			t.Fatalf("expected no insert, got %v", products)
+			return nil, nil
+		},
+	}
+
+	body := `[{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"name":"","price":{"amount":"3","currency":"EUR"}}]`
+	req, _ := http.NewRequest("POST", "/products/bulk", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	if !strings.Contains(rr.Body.String(), "Item 1: Name is required") {
+		t.Errorf("expected the failing item in the error, got %s", rr.Body.String())
+	}
+}
+
+func TestBulkCreate_PartialInvalidItem(t *testing.T) {
+	var received []models.Product
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			received = products
+			return []repository.BatchResult{{ID: 7}, {ID: 8}}, nil
+		},
+	}
+
+	body := `[{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"name":"","price":{"amount":"3","currency":"EUR"}},{"name":"Milk","price":{"amount":"1","currency":"EUR"}}]`
+	req, _ := http.NewRequest("POST", "/products/bulk?mode=partial", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusMultiStatus {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusMultiStatus, status, rr.Body.String())
+	}
+	if len(received) != 2 || received[1].Name != "Milk" {
+		t.Errorf("expected only the valid products, got %v", received)
+	}
+	report := decodeReport(t, rr.Body)
+	if report.Atomic || report.Succeeded != 2 || report.Failed != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if r := report.Results[1]; r.Index != 1 || r.Status != http.StatusBadRequest || r.Error != "Name is required" {
+		t.Errorf("unexpected result for the invalid item %+v", r)
+	}
+	if r := report.Results[2]; r.Index != 2 || r.Status != http.StatusOK || r.ID != 8 {
+		t.Errorf("expected the last item to get the second ID, got %+v", r)
+	}
+}
+
+func TestBulkUpdate_AtomicFailure(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		UpdateProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			return nil, &repository.BatchError{Index: 1, Err: fmt.Errorf("no product found with ID 9: %w", repository.ErrNotFound)}
+		},
+	}
+
+	body := `[{"id":1,"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"id":9,"name":"Milk","price":{"amount":"1","currency":"EUR"}}]`
+	req, _ := http.NewRequest("PUT", "/products/bulk", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+	expected := `{"type":"/problems/product_not_found","title":"Product not found","status":404,"detail":"Item 1: Product not found","instance":"/products/bulk","code":"product_not_found"}`
+	if got := strings.TrimSpace(rr.Body.String()); got != expected {
+		t.Errorf("expected body %s, got %s", expected, got)
+	}
+}
+
+func TestBulkUpdate_Partial(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		UpdateProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			return []repository.BatchResult{
+				{ID: 1},
+				{ID: 2, Err: fmt.Errorf("product 2 is no longer at version 3: %w", repository.ErrVersionConflict)},
+			}, nil
+		},
+	}
+
+	body := `[{"id":1,"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"name":"No ID","price":{"amount":"1","currency":"EUR"}},{"id":2,"version":3,"name":"Milk","price":{"amount":"1","currency":"EUR"}}]`
+	req, _ := http.NewRequest("PUT", "/products/bulk?mode=partial", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusMultiStatus {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusMultiStatus, status, rr.Body.String())
+	}
+	report := decodeReport(t, rr.Body)
+	var statuses []int
+	for _, r := range report.Results {
+		statuses = append(statuses, r.Status)
+	}
+	if got := fmt.Sprint(statuses); got != "[200 400 412]" {
+		t.Errorf("expected statuses [200 400 412], got %s", got)
+	}
+	if report.Results[2].ID != 2 || report.Results[2].Error != "Product was modified by another request" {
+		t.Errorf("unexpected result %+v", report.Results[2])
+	}
+}
+
+func TestBulkDelete_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	id, _ := repo.InsertProduct(context.Background(), models.Product{Name: "Tea", Price: usd("1")})
+
+	req, _ := http.NewRequest("DELETE", "/products/bulk", bytes.NewBufferString(fmt.Sprintf("[%d, 999]", id)))
+	rr := serve(repo, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+	if _, err := repo.GetProductByID(context.Background(), id); err != nil {
+		t.Errorf("expected the failed atomic batch to keep the product, got %v", err)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/products/bulk?mode=partial", bytes.NewBufferString(fmt.Sprintf("[%d, 999]", id)))
+	rr = serve(repo, req)
+
+	if status := rr.Code; status != http.StatusMultiStatus {
+		t.Errorf("expected status code %d, got %d", http.StatusMultiStatus, status)
+	}
+	report := decodeReport(t, rr.Body)
+	if report.Succeeded != 1 || report.Failed != 1 || report.Results[1].Status != http.StatusNotFound {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if _, err := repo.GetProductByID(context.Background(), id); err == nil {
+		t.Errorf("expected the product to be deleted")
+	}
+}
+
+func TestBulk_InvalidRequests(t *testing.T) {
+	tooMany := "[" + strings.Repeat("1,", 1000) + "1]"
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+	}{
+		{"UnknownMode", "/products/bulk?mode=best_effort", `[1]`, http.StatusBadRequest},
+		{"UnknownParameter", "/products/bulk?dry_run=true", `[1]`, http.StatusBadRequest},
+		{"NotAnArray", "/products/bulk", `{"ids":[1]}`, http.StatusBadRequest},
+		{"Empty", "/products/bulk", `[]`, http.StatusBadRequest},
+		{"TooManyItems", "/products/bulk", tooMany, http.StatusRequestEntityTooLarge},
+		{"InvalidID", "/products/bulk", `[0]`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockManualProductRepository{
+				DeleteProductsFunc: func(ctx context.Context, ids []int64, atomic bool) ([]repository.BatchResult, error) {
+					t.Fatalf("expected no delete, got %v", ids)
+					return nil, nil
+				},
+			}
+
+			req, _ := http.NewRequest("DELETE", tt.url, bytes.NewBufferString(tt.body))
+			rr := serve(mockRepo, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestBulkCreate_OutlastsServerTimeouts(t *testing.T) {
+	var deadline time.Time
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			deadline, _ = ctx.Deadline()
+			// longer than the write timeout of the server
+			time.Sleep(300 * time.Millisecond)
+			return []repository.BatchResult{{ID: 1}}, nil
+		},
+	}
+	router := mux.NewRouter()
+	(&handlers.ProductHandler{Repo: mockRepo, BulkTimeout: time.Minute}).RegisterRoutes(router)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	body := `[{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}]`
+	resp, err := http.Post(server.URL+"/products/bulk", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected the bulk request to outlast the write timeout, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if remaining := time.Until(deadline); remaining < 30*time.Second || remaining > time.Minute {
+		t.Errorf("expected the bulk request to be bounded by its own timeout, got a deadline in %v", remaining)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func serveAdmin(repo repository.ProductRepository, adminToken string, req *http.Request) *httptest.ResponseRecorder {
+	handler := handlers.ProductHandler{Repo: repo, AdminToken: adminToken}
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestIncludeDeleted_RequiresAdmin(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			t.Fatal("expected no listing")
+			return repository.ProductPage{}, nil
+		},
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			t.Fatal("expected no get")
+			return models.Product{}, nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		status        int
+	}{
+		{"MissingToken", "s3cret", "", http.StatusUnauthorized},
+		{"WrongToken", "s3cret", "Bearer guess", http.StatusForbidden},
+		{"NotBearer", "s3cret", "Basic czNjcmV0", http.StatusUnauthorized},
+		{"NoAdminConfigured", "", "Bearer anything", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		for _, path := range []string{"/products/list?include_deleted=true", "/products/1?include_deleted=true"} {
+			t.Run(tt.name+path, func(t *testing.T) {
+				req, _ := http.NewRequest("GET", path, nil)
+				if tt.authorization != "" {
+					req.Header.Set("Authorization", tt.authorization)
+				}
+				rr := serveAdmin(mockRepo, tt.adminToken, req)
+
+				if rr.Code != tt.status {
+					t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestGetProductByID_AsOfDeletedRequiresAdmin(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	ctx := context.Background()
+	id, _ := repo.InsertProduct(ctx, models.Product{Name: "Deleted", Price: usd("10")})
+	before, _ := repo.GetProductByID(ctx, id)
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+	path := fmt.Sprintf("/products/%d?as_of=%s", id, url.QueryEscape(before.UpdatedAt.Format(time.RFC3339Nano)))
+
+	for _, authorization := range []string{"", "Bearer guess"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if rr := serveAdmin(repo, "s3cret", req); rr.Code != http.StatusNotFound {
+			t.Errorf("expected the past of a deleted product to be hidden with %q, got %d %s", authorization, rr.Code, rr.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveAdmin(repo, "s3cret", req)
+	var product models.Product
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&product) != nil || product.Name != "Deleted" || product.DeletedAt != nil {
+		t.Errorf("expected an admin to read the past of a deleted product, got %d %v", rr.Code, product)
+	}
+}
+
+func TestIncludeDeleted_Invalid(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/1?include_deleted=maybe", nil)
+	rr := serveAdmin(&repository.MockManualProductRepository{}, "s3cret", req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestGetAllProducts_IncludeDeleted(t *testing.T) {
+	var received repository.ListOptions
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			received = opts
+			return repository.ProductPage{Products: []models.Product{}}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/list?include_deleted=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveAdmin(mockRepo, "s3cret", req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if !received.Filter.IncludeDeleted {
+		t.Errorf("expected the filter to include deleted products, got %+v", received.Filter)
+	}
+}
+
+func TestGetProductByID_IncludeDeleted(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			if !opts.Filter.IncludeDeleted || len(opts.Filter.IDs) != 1 {
+				t.Errorf("unexpected list options %+v", opts)
+			}
+			if opts.Filter.IDs[0] != 1 {
+				return repository.ProductPage{Products: []models.Product{}}, nil
+			}
+			return repository.ProductPage{Products: []models.Product{
+				{ID: 1, Name: "Deleted", Price: usd("10"), Version: 2, DeletedAt: &deletedAt},
+			}}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1?include_deleted=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveAdmin(mockRepo, "s3cret", req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	var product models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if product.DeletedAt == nil || !product.DeletedAt.Equal(deletedAt) {
+		t.Errorf("expected the deletion time, got %v", product)
+	}
+
+	req, _ = http.NewRequest("GET", "/products/2?include_deleted=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr = serveAdmin(mockRepo, "s3cret", req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestRestoreProductByID_NotFound(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		RestoreProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
+		},
+	}
+
+	req, _ := http.NewRequest("POST", "/products/1/restore", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveAdmin(mockRepo, "s3cret", req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestRestoreProductByID_RequiresAdmin(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		RestoreProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			t.Fatal("expected no restore")
+			return models.Product{}, nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"MissingToken", "", http.StatusUnauthorized},
+		{"WrongToken", "Bearer guess", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/products/1/restore", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := serveAdmin(mockRepo, "s3cret", req)
+
+			if status := rr.Code; status != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, status)
+			}
+		})
+	}
+}
+
+func TestDeleteAndRestore_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	id, _ := repo.InsertProduct(context.Background(), models.Product{Name: "Test Product", Price: usd("10")})
+	path := fmt.Sprintf("/products/%d", id)
+
+	steps := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"DELETE", path, http.StatusOK},
+		{"GET", path, http.StatusNotFound},
+		{"POST", path + "/restore", http.StatusOK},
+		{"GET", path, http.StatusOK},
+	}
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := serveAdmin(repo, "s3cret", req)
+
+		if rr.Code != step.status {
+			t.Fatalf("%s %s: expected status code %d, got %d", step.method, step.path, step.status, rr.Code)
+		}
+	}
+}
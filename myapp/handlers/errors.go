@@ -2,19 +2,165 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
 	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/bda-mota/MyFirstCRUD/myapp/validate"
 )
 
-func ResponseError(w http.ResponseWriter, message string, errorCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(errorCode)
+// Problem codes name the kind of an error for programs. They are part of the
+// API: a code keeps its meaning once published, and clients may switch on it.
+const (
+	CodeInvalidProductID         = "invalid_product_id"
+	CodeInvalidParameter         = "invalid_parameter"
+	CodeMalformedBody            = "malformed_body"
+	CodeValidationFailed         = "validation_failed"
+	CodeBodyTooLarge             = "body_too_large"
+	CodeTooManyItems             = "too_many_items"
+	CodeUnsupportedMediaType     = "unsupported_media_type"
+	CodeNotAcceptable            = "not_acceptable"
+	CodeAdminTokenRequired       = "admin_token_required"
+	CodeAdminTokenInvalid        = "admin_token_invalid"
+	CodeProductNotFound          = "product_not_found"
+	CodeRouteNotFound            = "route_not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeProductConflict          = "product_conflict"
+	CodeVersionConflict          = "version_conflict"
+	CodePreconditionFailed       = "precondition_failed"
+	CodeInvalidPatch             = "invalid_patch"
+	CodePatchTestFailed          = "patch_test_failed"
+	CodeImmutableField           = "immutable_field"
+	CodeInvalidIdempotencyKey    = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeServiceUnavailable       = "service_unavailable"
+	CodeInternalError            = "internal_error"
+)
+
+// problemTitles are the summaries of the problem codes. Like the codes, they
+// do not change from one occurrence to the next.
+var problemTitles = map[string]string{
+	CodeInvalidProductID:         "Invalid product ID",
+	CodeInvalidParameter:         "Invalid query parameter",
+	CodeMalformedBody:            "Malformed request body",
+	CodeValidationFailed:         "Validation failed",
+	CodeBodyTooLarge:             "Request body too large",
+	CodeTooManyItems:             "Too many items",
+	CodeUnsupportedMediaType:     "Unsupported media type",
+	CodeNotAcceptable:            "Not acceptable",
+	CodeAdminTokenRequired:       "Admin token required",
+	CodeAdminTokenInvalid:        "Invalid admin token",
+	CodeProductNotFound:          "Product not found",
+	CodeRouteNotFound:            "Route not found",
+	CodeMethodNotAllowed:         "Method not allowed",
+	CodeProductConflict:          "Product conflict",
+	CodeVersionConflict:          "Version conflict",
+	CodePreconditionFailed:       "Precondition failed",
+	CodeInvalidPatch:             "Invalid patch",
+	CodePatchTestFailed:          "Patch test failed",
+	CodeImmutableField:           "Immutable field",
+	CodeInvalidIdempotencyKey:    "Invalid idempotency key",
+	CodeIdempotencyKeyReused:     "Idempotency key reused",
+	CodeIdempotencyKeyInProgress: "Idempotency key in progress",
+	CodeServiceUnavailable:       "Service unavailable",
+	CodeInternalError:            "Internal error",
+}
+
+// ProblemTypeBase prefixes the code of a problem to form its type URI. The
+// URI is relative to the API.
+const ProblemTypeBase = "/problems/"
+
+// problemMediaTypes are the problem media types of the codecs that have one.
+// Problems are sent as JSON to clients negotiating another media type.
+var problemMediaTypes = map[string]string{
+	"application/json": "application/problem+json",
+	"application/xml":  "application/problem+xml",
+}
+
+// writeProblem writes p as RFC 7807 problem details. Type, title and instance
+// are filled in when empty.
+func writeProblem(w http.ResponseWriter, p models.Problem) {
+	if p.Type == "" {
+		p.Type = ProblemTypeBase + p.Code
+	}
+	if p.Title == "" {
+		p.Title = problemTitles[p.Code]
+	}
+
+	var c codec.Codec = codec.JSON{}
+	mediaType := problemMediaTypes[c.MediaType()]
+	if nw, ok := w.(*negotiatedWriter); ok {
+		if p.Instance == "" {
+			p.Instance = nw.instance
+		}
+		if nw.codec != nil && problemMediaTypes[nw.codec.MediaType()] != "" {
+			c, mediaType = nw.codec, problemMediaTypes[nw.codec.MediaType()]
+		}
+	}
 
-	responseError := models.RequestError{
-		Message:   message,
-		ErrorCode: errorCode,
+	body, err := encodeWith(c, p)
+	if err != nil {
+		body, _ = json.Marshal(p)
+		mediaType = problemMediaTypes["application/json"]
 	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// Problem answers with status and a problem of the given code. detail tells
+// what went wrong this time.
+func Problem(w http.ResponseWriter, status int, code, detail string) {
+	writeProblem(w, models.Problem{Status: status, Code: code, Detail: detail})
+}
+
+// validationProblem answers with status and the field errors of err, the
+// fields being relative to the JSON Pointer prefix.
+func validationProblem(w http.ResponseWriter, status int, detail string, err error, prefix string) {
+	p := models.Problem{Status: status, Code: CodeValidationFailed, Detail: detail}
+	var errs validate.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			p.Errors = append(p.Errors, models.FieldError{Field: prefix + e.Field, Code: e.Code, Message: e.Message})
+		}
+	}
+	writeProblem(w, p)
+}
+
+// RepositoryError maps an error returned by the repository to its HTTP status.
+// message is only sent when the error has no more specific meaning.
+func RepositoryError(w http.ResponseWriter, err error, message string) {
+	status, code, detail := repositoryProblem(err, message)
+	Problem(w, status, code, detail)
+}
+
+// repositoryProblem returns the status, code and detail RepositoryError sends
+// for err.
+func repositoryProblem(err error, message string) (int, string, string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, CodeProductNotFound, "Product not found"
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict, CodeProductConflict, "Product conflicts with an existing product"
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed, CodeVersionConflict, "Product was modified by another request"
+	case errors.Is(err, repository.ErrValidation):
+		// the same answer as a product failing validateProduct, whichever
+		// layer caught it
+		return http.StatusBadRequest, CodeValidationFailed, "Invalid product"
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable"
+	default:
+		return http.StatusInternalServerError, CodeInternalError, message
+	}
+}
 
-	json.NewEncoder(w).Encode(responseError)
+// itemDetail prefixes detail with the index of the item of a bulk request it
+// is about.
+func itemDetail(i int, detail string) string {
+	return fmt.Sprintf("Item %d: %s", i, detail)
 }
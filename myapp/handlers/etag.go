@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// ETag is a strong validator computed from the JSON representation of p, so
+// it changes whenever the product does.
+func ETag(p models.Product) string {
+	body, _ := json.Marshal(p)
+	return etagFor(body)
+}
+
+func etagFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header value matches
+// etag. If-Match uses the strong comparison, so weak validators only match
+// when weak is set.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch answers 412 and returns false when the request has an If-Match
+// header that does not match the current product.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current models.Product) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || matchETag(ifMatch, ETag(current), false) {
+		return true
+	}
+	Problem(w, http.StatusPreconditionFailed, CodePreconditionFailed, "Product does not match If-Match")
+	return false
+}
+
+// notModified evaluates If-None-Match and, when it is absent, If-Modified-Since
+// against the representation about to be sent. A zero lastModified disables
+// the date check.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return matchETag(ifNoneMatch, etag, true)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have no fraction of a second
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// writeCacheable writes v in the negotiated media type with its ETag and
+// Last-Modified headers, or only the headers with 304 Not Modified when the
+// client's copy is current. The ETag is taken from the JSON representation
+// whatever the media type, so that it can be sent back in If-Match.
+func writeCacheable(w http.ResponseWriter, r *http.Request, v interface{}, lastModified time.Time) {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		Problem(w, http.StatusInternalServerError, CodeInternalError, "could not encode response")
+		return
+	}
+	body, mediaType, err := encode(w, v)
+	if errors.Is(err, errNotAcceptable) || errors.Is(err, codec.ErrUnsupported) {
+		notAcceptable(w)
+		return
+	} else if err != nil {
+		Problem(w, http.StatusInternalServerError, CodeInternalError, "could not encode response")
+		return
+	}
+
+	etag := etagFor(doc)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
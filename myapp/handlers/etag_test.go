@@ -0,0 +1,237 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/jsonpatch"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+var versioned = models.Product{
+	ID:        1,
+	Name:      "Test Product",
+	Price:     usd("10"),
+	Version:   3,
+	CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	UpdatedAt: time.Date(2024, 5, 2, 10, 30, 0, 500, time.UTC),
+}
+
+func versionedMock(updated *models.Product) *repository.MockManualProductRepository {
+	return &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return versioned, nil
+		},
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			return repository.ProductPage{Products: []models.Product{versioned}, Total: 1}, nil
+		},
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+			*updated = p
+			return nil
+		},
+	}
+}
+
+func serve(repo repository.ProductRepository, req *http.Request) *httptest.ResponseRecorder {
+	return serveHandler(&handlers.ProductHandler{Repo: repo}, req)
+}
+
+func serveHandler(handler *handlers.ProductHandler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetProductByID_ETag(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/1", nil)
+	rr := serve(versionedMock(new(models.Product)), req)
+
+	if etag := rr.Header().Get("ETag"); etag != handlers.ETag(versioned) {
+		t.Errorf("expected ETag %q, got %q", handlers.ETag(versioned), etag)
+	}
+	if lastModified := rr.Header().Get("Last-Modified"); lastModified != "Thu, 02 May 2024 10:30:00 GMT" {
+		t.Errorf("unexpected Last-Modified %q", lastModified)
+	}
+
+	changed := versioned
+	changed.Price = usd("11")
+	if handlers.ETag(changed) == handlers.ETag(versioned) {
+		t.Error("expected the ETag to change with the product")
+	}
+}
+
+func TestGetProductByID_Conditional(t *testing.T) {
+	etag := handlers.ETag(versioned)
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"IfNoneMatchCurrent", "If-None-Match", etag, http.StatusNotModified},
+		{"IfNoneMatchWeak", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"IfNoneMatchAny", "If-None-Match", "*", http.StatusNotModified},
+		{"IfNoneMatchStale", "If-None-Match", `"other"`, http.StatusOK},
+		{"IfModifiedSinceSameSecond", "If-Modified-Since", "Thu, 02 May 2024 10:30:00 GMT", http.StatusNotModified},
+		{"IfModifiedSinceLater", "If-Modified-Since", "Fri, 03 May 2024 00:00:00 GMT", http.StatusNotModified},
+		{"IfModifiedSinceEarlier", "If-Modified-Since", "Thu, 02 May 2024 10:29:59 GMT", http.StatusOK},
+		{"IfModifiedSinceInvalid", "If-Modified-Since", "yesterday", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products/1", nil)
+			req.Header.Set(tt.header, tt.value)
+			rr := serve(versionedMock(new(models.Product)), req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("expected no body, got %s", rr.Body.String())
+			}
+			if rr.Header().Get("ETag") != etag {
+				t.Errorf("expected ETag %q, got %q", etag, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestGetProductByID_IfNoneMatchBeforeIfModifiedSince(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/1", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+	req.Header.Set("If-Modified-Since", "Fri, 03 May 2024 00:00:00 GMT")
+	rr := serve(versionedMock(new(models.Product)), req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, status)
+	}
+}
+
+func TestGetAllProducts_Conditional(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/list", nil)
+	rr := serve(versionedMock(new(models.Product)), req)
+
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected status code %d with an ETag, got %d and %q", http.StatusOK, rr.Code, etag)
+	}
+	if rr.Header().Get("Last-Modified") != "" {
+		t.Errorf("expected no Last-Modified on a list, got %q", rr.Header().Get("Last-Modified"))
+	}
+
+	req, _ = http.NewRequest("GET", "/products/list", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = serve(versionedMock(new(models.Product)), req)
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("expected status code %d, got %d", http.StatusNotModified, status)
+	}
+	if rr.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("expected X-Total-Count on 304, got %q", rr.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestUpdateProductByID_IfMatch(t *testing.T) {
+	etag := handlers.ETag(versioned)
+	tests := []struct {
+		ifMatch string
+		status  int
+	}{
+		{etag, http.StatusOK},
+		{`"other", ` + etag, http.StatusOK},
+		{`*`, http.StatusOK},
+		{`"other"`, http.StatusPreconditionFailed},
+		{`W/` + etag, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ifMatch, func(t *testing.T) {
+			var updated models.Product
+			req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBufferString(`{"name":"New name","price":{"amount":"20","currency":"USD"}}`))
+			req.Header.Set("If-Match", tt.ifMatch)
+			rr := serve(versionedMock(&updated), req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK && updated.Version != 3 {
+				t.Errorf("expected the update to require version 3, got %d", updated.Version)
+			}
+			if tt.status == http.StatusPreconditionFailed && updated.Name != "" {
+				t.Errorf("expected no update, got %v", updated)
+			}
+		})
+	}
+}
+
+func TestUpdateProductByID_VersionConflict(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+			return fmt.Errorf("product %d is no longer at version %d: %w", id, p.Version, repository.ErrVersionConflict)
+		},
+	}
+
+	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBufferString(`{"name":"New name","price":{"amount":"20","currency":"USD"},"version":2}`))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusPreconditionFailed {
+		t.Errorf("expected status code %d, got %d", http.StatusPreconditionFailed, status)
+	}
+	actualResponse := strings.TrimSpace(rr.Body.String())
+	expectedResponse := `{"type":"/problems/version_conflict","title":"Version conflict","status":412,"detail":"Product was modified by another request","instance":"/products/1","code":"version_conflict"}`
+	if actualResponse != expectedResponse {
+		t.Errorf("expected body %s, got %s", expectedResponse, actualResponse)
+	}
+}
+
+func TestPatchProductByID_IfMatch(t *testing.T) {
+	mockRepo := versionedMock(new(models.Product))
+	mockRepo.PatchProductByIDFunc = func(ctx context.Context, id int64, changes repository.ProductChanges) (models.Product, error) {
+		t.Fatalf("expected no patch, got %+v", changes)
+		return models.Product{}, nil
+	}
+
+	req, _ := http.NewRequest("PATCH", "/products/1", bytes.NewBufferString(`{"price":{"amount":"20","currency":"USD"}}`))
+	req.Header.Set("Content-Type", jsonpatch.MergePatchType)
+	req.Header.Set("If-Match", `"other"`)
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusPreconditionFailed {
+		t.Errorf("expected status code %d, got %d", http.StatusPreconditionFailed, status)
+	}
+}
+
+func TestConcurrentUpdates_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	id, _ := repo.InsertProduct(context.Background(), models.Product{Name: "Test Product", Price: usd("10")})
+	read, _ := repo.GetProductByID(context.Background(), id)
+
+	// both clients read the same product, only the first write may succeed
+	for i, status := range []int{http.StatusOK, http.StatusPreconditionFailed} {
+		body := fmt.Sprintf(`{"name":"Client %d","price":{"amount":"20","currency":"USD"}}`, i)
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/products/%d", id), strings.NewReader(body))
+		req.Header.Set("If-Match", handlers.ETag(read))
+		rr := serve(repo, req)
+
+		if rr.Code != status {
+			t.Errorf("client %d: expected status code %d, got %d", i, status, rr.Code)
+		}
+	}
+
+	got, _ := repo.GetProductByID(context.Background(), id)
+	if got.Name != "Client 0" || got.Version != 2 {
+		t.Errorf("expected the first client's update at version 2, got %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+)
+
+// exportColumns are the columns of the CSV and XLSX exports. Columns added
+// later go at the end, so the existing ones keep their position.
+var exportColumns = []string{"id", "name", "price", "currency", "version", "created_at", "updated_at", "deleted_at", "sku"}
+
+// productWriter writes the products of an export in one format. Close ends
+// the document but not the response.
+type productWriter interface {
+	Write(p models.Product) error
+	Close() error
+}
+
+type exportFormat struct {
+	contentType string
+	newWriter   func(w io.Writer) productWriter
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":    {"text/csv; charset=utf-8", newCSVExport},
+	"ndjson": {"application/x-ndjson", newNDJSONExport},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExport},
+}
+
+// exportRecord lists the values of p in the order of exportColumns. Prices
+// have the minor units of their currency and times are RFC 3339.
+func exportRecord(p models.Product) []string {
+	minor, _ := money.MinorUnits(p.Price.Currency)
+	var deletedAt string
+	if p.DeletedAt != nil {
+		deletedAt = p.DeletedAt.Format(time.RFC3339Nano)
+	}
+	return []string{
+		strconv.FormatInt(p.ID, 10),
+		p.Name,
+		p.Price.Amount.Format(minor),
+		p.Price.Currency,
+		strconv.FormatInt(p.Version, 10),
+		p.CreatedAt.Format(time.RFC3339Nano),
+		p.UpdatedAt.Format(time.RFC3339Nano),
+		deletedAt,
+		p.SKU,
+	}
+}
+
+type csvExport struct {
+	buf *bufio.Writer
+	w   *csv.Writer
+}
+
+func newCSVExport(w io.Writer) productWriter {
+	buf := bufio.NewWriterSize(w, 32<<10)
+	e := csvExport{buf, csv.NewWriter(buf)}
+	e.w.Write(exportColumns)
+	return e
+}
+
+func (e csvExport) Write(p models.Product) error {
+	return e.w.Write(exportRecord(p))
+}
+
+func (e csvExport) Close() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return err
+	}
+	return e.buf.Flush()
+}
+
+type ndjsonExport struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONExport(w io.Writer) productWriter {
+	buf := bufio.NewWriterSize(w, 32<<10)
+	return ndjsonExport{buf, json.NewEncoder(buf)}
+}
+
+func (e ndjsonExport) Write(p models.Product) error {
+	return e.enc.Encode(p)
+}
+
+func (e ndjsonExport) Close() error {
+	return e.buf.Flush()
+}
+
+type xlsxExport struct{ x *xlsxWriter }
+
+func newXLSXExport(w io.Writer) productWriter {
+	e := xlsxExport{newXLSXWriter(w)}
+	header := make([]xlsxCell, len(exportColumns))
+	for i, name := range exportColumns {
+		header[i] = xlsxCell{Value: name}
+	}
+	e.x.WriteRow(header)
+	return e
+}
+
+func (e xlsxExport) Write(p models.Product) error {
+	record := exportRecord(p)
+	cells := make([]xlsxCell, len(record))
+	for i, v := range record {
+		// id, price and version are numbers
+		cells[i] = xlsxCell{Value: v, Number: i == 0 || i == 2 || i == 4}
+	}
+	return e.x.WriteRow(cells)
+}
+
+func (e xlsxExport) Close() error {
+	return e.x.Close()
+}
+
+// EXPORT
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := checkParameters(query, exportParameters); err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	name := query.Get("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, "format must be csv, ndjson or xlsx")
+		return
+	}
+	filter, err := parseProductFilter(query)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	sort, err := parseSort(query)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	if filter.IncludeDeleted && !h.requireAdmin(w, r) {
+		return
+	}
+
+	// an export streams for as long as the client takes to read it, which
+	// the server's write timeout would cut short behind a 200, so it gets a
+	// longer deadline of its own; the context ends the database transaction
+	// with it, or when the client goes away
+	ctx := r.Context()
+	if h.ExportTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.ExportTimeout)
+		defer cancel()
+		// fails silently where it cannot be set, such as in tests
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(h.ExportTimeout))
+	}
+
+	// the response starts with the first product, so an error before it
+	// can still be answered with a status
+	var out productWriter
+	start := func() {
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="products.`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		out = format.newWriter(w)
+	}
+	err = h.Repo.ExportProducts(ctx, filter, sort, func(p models.Product) error {
+		if out == nil {
+			start()
+		}
+		return out.Write(p)
+	})
+	if err == nil {
+		if out == nil {
+			start()
+		}
+		err = out.Close()
+	}
+
+	if err != nil && out == nil {
+		RepositoryError(w, err, "could not export products")
+	} else if err != nil {
+		// too late for a status: break the connection so the client does not
+		// take a truncated export for a complete one
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func exportRepo(t *testing.T) repository.ProductRepository {
+	t.Helper()
+
+	repo := repository.NewMemoryProductRepository()
+	for _, p := range []models.Product{
+		{Name: "Tea", Price: money.MustParse("2.5", "EUR")},
+		{Name: `Coffee, "ground"`, Price: usd("3")},
+		{Name: "Yen <cake>", Price: money.MustParse("500", "JPY")},
+	} {
+		if _, err := repo.InsertProduct(context.Background(), p); err != nil {
+			t.Fatalf("unexpected insert error: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestExportProducts_CSV(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/export?sort=-price&max_price=100", nil)
+	rr := serve(exportRepo(t), req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="products.csv"` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != "id,name,price,currency,version,created_at,updated_at,deleted_at,sku" {
+		t.Fatalf("expected a header and 2 products, got %v", records)
+	}
+	if records[1][1] != `Coffee, "ground"` || records[1][2] != "3.00" || records[2][2] != "2.50" || records[2][3] != "EUR" {
+		t.Errorf("expected the filtered products by descending price, got %v", records[1:])
+	}
+}
+
+func TestExportProducts_NDJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/export?format=ndjson&currency=JPY", nil)
+	rr := serve(exportRepo(t), req)
+
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || ct != "application/x-ndjson" {
+		t.Fatalf("unexpected response %d %q", rr.Code, ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	var p models.Product
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &p) != nil || p.Name != "Yen <cake>" || p.Price != money.MustParse("500", "JPY") {
+		t.Errorf("expected one JPY product, got %q", lines)
+	}
+}
+
+func TestExportProducts_XLSX(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/export?format=xlsx", nil)
+	rr := serve(exportRepo(t), req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	body := rr.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("expected a zip archive, got %v", err)
+	}
+
+	var sheet []byte
+	for _, f := range archive.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			sheet, _ = io.ReadAll(r)
+			r.Close()
+		}
+	}
+	for _, want := range []string{
+		`<row r="4">`,
+		`<t xml:space="preserve">Yen &lt;cake&gt;</t>`,
+		`<t xml:space="preserve">Coffee, &#34;ground&#34;</t>`,
+		`<c><v>2.50</v></c>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !bytes.Contains(sheet, []byte(want)) {
+			t.Errorf("expected the sheet to contain %s, got %s", want, sheet)
+		}
+	}
+}
+
+func TestExportProducts_Errors(t *testing.T) {
+	for _, query := range []string{"format=pdf", "limit=10", "min_price=cheap", "sort=weight", "include_deleted=true"} {
+		mockRepo := &repository.MockManualProductRepository{
+			ExportProductsFunc: func(ctx context.Context, filter repository.ProductFilter, sort []repository.SortField, fn func(models.Product) error) error {
+				t.Fatalf("%s: expected no export", query)
+				return nil
+			},
+		}
+
+		req, _ := http.NewRequest("GET", "/products/export?"+query, nil)
+		rr := serve(mockRepo, req)
+		if rr.Code != http.StatusBadRequest && rr.Code != http.StatusUnauthorized && rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected the request to be refused, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestExportProducts_RepositoryError(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ExportProductsFunc: func(ctx context.Context, filter repository.ProductFilter, sort []repository.SortField, fn func(models.Product) error) error {
+			return repository.ErrUnavailable
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/export", nil)
+	rr := serve(mockRepo, req)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, status)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("expected no attachment, got %q", cd)
+	}
+}
+
+func TestExportProducts_ErrorAfterStart(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ExportProductsFunc: func(ctx context.Context, filter repository.ProductFilter, sort []repository.SortField, fn func(models.Product) error) error {
+			if err := fn(models.Product{ID: 1, Name: "Tea", Price: usd("1")}); err != nil {
+				return err
+			}
+			return repository.ErrUnavailable
+		},
+	}
+
+	defer func() {
+		if err := recover(); err == nil || !errors.Is(err.(error), http.ErrAbortHandler) {
+			t.Errorf("expected the handler to abort, got %v", err)
+		}
+	}()
+	req, _ := http.NewRequest("GET", "/products/export", nil)
+	serve(mockRepo, req)
+}
+
+func TestExportProducts_OutlastsWriteTimeout(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ExportProductsFunc: func(ctx context.Context, filter repository.ProductFilter, sort []repository.SortField, fn func(models.Product) error) error {
+			for id := int64(1); id <= 3; id++ {
+				if err := fn(models.Product{ID: id, Name: "Tea", Price: usd("1")}); err != nil {
+					return err
+				}
+				// together longer than the write timeout of the server
+				time.Sleep(100 * time.Millisecond)
+			}
+			return nil
+		},
+	}
+	router := mux.NewRouter()
+	(&handlers.ProductHandler{Repo: mockRepo, ExportTimeout: time.Minute}).RegisterRoutes(router)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 150 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/products/export?format=ndjson")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if lines := strings.Count(string(body), "\n"); err != nil || lines != 3 {
+		t.Errorf("expected the whole export, got %d lines and %v", lines, err)
+	}
+}
+
+func TestExportProducts_Timeout(t *testing.T) {
+	ended := make(chan error, 1)
+	mockRepo := &repository.MockManualProductRepository{
+		ExportProductsFunc: func(ctx context.Context, filter repository.ProductFilter, sort []repository.SortField, fn func(models.Product) error) error {
+			if err := fn(models.Product{ID: 1, Name: "Tea", Price: usd("1")}); err != nil {
+				return err
+			}
+			// an export that never completes, like one read by a client that
+			// stopped reading
+			<-ctx.Done()
+			ended <- ctx.Err()
+			return ctx.Err()
+		},
+	}
+	router := mux.NewRouter()
+	(&handlers.ProductHandler{Repo: mockRepo, ExportTimeout: 100 * time.Millisecond}).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// the first product may still sit in a buffer, so the connection breaks
+	// either before the headers or in the middle of the body
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + "/products/export?format=ndjson")
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Errorf("expected the cancelled export to be cut short")
+	}
+
+	select {
+	case err := <-ended:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the export to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the export to be cancelled")
+	}
+}
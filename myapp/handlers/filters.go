@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+// MaxFilterIDs caps the number of IDs accepted by the ids filter.
+const MaxFilterIDs = 100
+
+// DefaultSearchSize is the number of search results returned without a limit.
+const DefaultSearchSize = 20
+
+// listParameters are the query parameters accepted by the list endpoint.
+var listParameters = map[string]bool{
+	"limit": true, "offset": true, "after": true,
+	"name_contains": true, "min_price": true, "max_price": true, "currency": true, "ids": true,
+	"sort": true, "include_deleted": true,
+}
+
+// searchParameters are the query parameters accepted by the search endpoint.
+var searchParameters = map[string]bool{"q": true, "limit": true}
+
+// historyParameters are the query parameters accepted by the history endpoint.
+var historyParameters = map[string]bool{"limit": true, "after": true}
+
+// bulkParameters are the query parameters accepted by the bulk endpoints.
+var bulkParameters = map[string]bool{"mode": true}
+
+// exportParameters are the query parameters accepted by the export endpoint:
+// the filters and sort of the list endpoint, and format.
+var exportParameters = map[string]bool{
+	"name_contains": true, "min_price": true, "max_price": true, "currency": true, "ids": true,
+	"sort": true, "include_deleted": true, "format": true,
+}
+
+// importParameters are the query parameters accepted by the import endpoint.
+var importParameters = map[string]bool{"dry_run": true}
+
+func checkParameters(query url.Values, allowed map[string]bool) error {
+	var unknown []string
+	for name := range query {
+		if !allowed[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown query parameters: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// parseProductFilter reads name_contains, min_price, max_price, currency, ids
+// and include_deleted.
+func parseProductFilter(query url.Values) (repository.ProductFilter, error) {
+	filter := repository.ProductFilter{NameContains: query.Get("name_contains")}
+
+	var err error
+	if filter.IncludeDeleted, err = parseIncludeDeleted(query); err != nil {
+		return filter, err
+	}
+
+	for name, dst := range map[string]**money.Amount{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		price, err := money.ParseAmount(v)
+		if err != nil || price < 0 {
+			return filter, fmt.Errorf("%s must be a non-negative decimal number", name)
+		}
+		*dst = &price
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, errors.New("min_price must not be greater than max_price")
+	}
+
+	if v := query.Get("currency"); v != "" {
+		if _, ok := money.MinorUnits(v); !ok {
+			return filter, errors.New("currency must be an ISO 4217 code such as EUR")
+		}
+		filter.Currency = v
+	}
+
+	if v := query.Get("ids"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) > MaxFilterIDs {
+			return filter, fmt.Errorf("ids accepts at most %d IDs", MaxFilterIDs)
+		}
+		for _, part := range parts {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil || id < 1 {
+				return filter, fmt.Errorf("invalid product ID %q in ids", part)
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseIncludeDeleted reads include_deleted, which only admins may set.
+func parseIncludeDeleted(query url.Values) (bool, error) {
+	v := query.Get("include_deleted")
+	if v == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("include_deleted must be true or false")
+	}
+	return include, nil
+}
+
+// parseBulkMode reads mode, which is atomic unless set to partial.
+func parseBulkMode(query url.Values) (atomic bool, err error) {
+	switch query.Get("mode") {
+	case "", "atomic":
+		return true, nil
+	case "partial":
+		return false, nil
+	default:
+		return false, errors.New("mode must be atomic or partial")
+	}
+}
+
+// parseDryRun reads dry_run, which is false unless set.
+func parseDryRun(query url.Values) (bool, error) {
+	v := query.Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("dry_run must be true or false")
+	}
+	return dryRun, nil
+}
+
+// parseAsOf reads as_of, an RFC 3339 instant. It returns the zero time when
+// as_of is not set.
+func parseAsOf(query url.Values) (time.Time, error) {
+	v := query.Get("as_of")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	asOf, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, errors.New("as_of must be an RFC 3339 time such as 2024-05-01T10:00:00Z")
+	}
+	return asOf, nil
+}
+
+// parseSort reads sort=field,-field where a leading - sorts descending.
+func parseSort(query url.Values) ([]repository.SortField, error) {
+	v := query.Get("sort")
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields []repository.SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(v, ",") {
+		field := repository.SortField{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field, field.Desc = field.Field[1:], true
+		}
+		if !repository.IsSortable(field.Field) {
+			return nil, fmt.Errorf("cannot sort by %q, expected id, name or price", field.Field)
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("sort field %q is repeated", field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func TestGetAll_FilterAndSort(t *testing.T) {
+	var received repository.ListOptions
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			received = opts
+			return repository.ProductPage{Products: []models.Product{}}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	req, _ := http.NewRequest("GET", "/products/list?name_contains=app&min_price=1.5&max_price=10&currency=EUR&ids=3,1,2&sort=price,-name", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	filter := received.Filter
+	if filter.NameContains != "app" || filter.MinPrice == nil || *filter.MinPrice != 15000 ||
+		filter.MaxPrice == nil || *filter.MaxPrice != 100000 || len(filter.IDs) != 3 || filter.IDs[0] != 3 || filter.Currency != "EUR" {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+
+	expectedSort := []repository.SortField{{Field: "price"}, {Field: "name", Desc: true}}
+	if len(received.Sort) != 2 || received.Sort[0] != expectedSort[0] || received.Sort[1] != expectedSort[1] {
+		t.Errorf("expected sort %v, got %v", expectedSort, received.Sort)
+	}
+}
+
+func TestGetAll_InvalidFilterAndSort(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{}
+	handler := handlers.ProductHandler{Repo: mockRepo}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+
+	for _, query := range []string{
+		"min_price=cheap",
+		"max_price=-1",
+		"min_price=10&max_price=5",
+		"min_price=1e3",
+		"currency=eur",
+		"currency=XYZ",
+		"ids=1,two",
+		"ids=0",
+		"sort=weight",
+		"sort=price,-price",
+		"color=red",
+	} {
+		req, _ := http.NewRequest("GET", "/products/list?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, status)
+		}
+	}
+}
@@ -1,46 +1,93 @@
 package handlers
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/idempotency"
+	"github.com/bda-mota/MyFirstCRUD/myapp/jsonpatch"
 	"github.com/bda-mota/MyFirstCRUD/myapp/models"
 	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/bda-mota/MyFirstCRUD/myapp/validate"
 	"github.com/gorilla/mux"
 )
 
+// maxPatchSize caps the size of a PATCH body.
+const maxPatchSize = 1 << 20
+
 type ProductHandler struct {
 	Repo repository.ProductRepository
+	// AdminToken grants access to deleted products. Empty disables it.
+	AdminToken string
+	// ImportTimeout bounds an import, from reading its body to writing its
+	// report, in place of the server timeouts. Zero keeps them.
+	ImportTimeout time.Duration
+	// BulkTimeout bounds a bulk request in the same way, since its items
+	// take longer than the database query timeout together. Zero keeps the
+	// server timeouts.
+	BulkTimeout time.Duration
+	// ExportTimeout bounds an export, from querying the products to writing
+	// the last of them, in place of the server write timeout. Zero keeps it.
+	ExportTimeout time.Duration
+	// ProxyToken authenticates the proxy setting X-Actor, see requestContext.
+	// Empty means X-Actor is never trusted.
+	ProxyToken string
+	// Codecs are the media types offered to clients. Nil means DefaultCodecs.
+	Codecs *codec.Registry
+	// Idempotency stores the responses of requests sent with an
+	// Idempotency-Key. Nil ignores the header.
+	Idempotency idempotency.Store
 }
 
-// POST
-func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
-	var newProduct models.Product
+func validateProduct(p models.Product) error {
+	return validate.Struct(p)
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&newProduct); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+// extendTimeout bounds a request that outlasts the server timeouts by its own
+// timeout instead, from reading its body to writing its response, and
+// returns it with a context ending then. Zero keeps the server timeouts.
+func extendTimeout(w http.ResponseWriter, r *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	if timeout <= 0 {
+		return r, func() {}
 	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	// the connection deadlines fail silently where they cannot be set, such
+	// as in tests
+	deadline := time.Now().Add(timeout)
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+	return r.WithContext(ctx), cancel
+}
 
-	if newProduct.Name == "" {
-		ResponseError(w, "Name is required", http.StatusBadRequest)
+// POST
+func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var newProduct models.Product
+	if !decodeBody(w, r, &newProduct, maxBodySize) {
 		return
 	}
-	if newProduct.Price <= 0 {
-		ResponseError(w, "Price must be greater than 0", http.StatusBadRequest)
+
+	if err := validateProduct(newProduct); err != nil {
+		validationProblem(w, http.StatusBadRequest, err.Error(), err, "")
 		return
 	}
 
-	id, err := h.Repo.InsertProduct(newProduct)
+	id, err := h.Repo.InsertProduct(r.Context(), newProduct)
 	if err != nil {
-		ResponseError(w, "Could not insert the product", http.StatusInternalServerError)
+		RepositoryError(w, err, "Could not insert the product")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	respond(w, http.StatusOK, map[string]interface{}{
 		"message": "Product created successfully",
 		"id":      id,
 	})
@@ -53,23 +100,66 @@ func (h *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request)
 
 	convertedId, err := strconv.ParseInt(productID, 10, 64)
 	if err != nil {
-		ResponseError(w, "invalid product ID", http.StatusBadRequest)
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
 		return
 	}
 
-	getProduct, err := h.Repo.GetProductByID(convertedId)
+	includeDeleted, err := parseIncludeDeleted(r.URL.Query())
 	if err != nil {
-		ResponseError(w, "could not retrieve product", http.StatusInternalServerError)
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
 		return
 	}
-	if getProduct.ID == 0 {
-		ResponseError(w, "Product not found", http.StatusNotFound)
+	asOf, err := parseAsOf(r.URL.Query())
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
 		return
 	}
+	if includeDeleted && !asOf.IsZero() {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, "as_of and include_deleted cannot be used together")
+		return
+	}
+	if includeDeleted && !h.requireAdmin(w, r) {
+		return
+	}
+
+	var getProduct models.Product
+	if asOf.IsZero() {
+		getProduct, err = h.getProduct(r.Context(), convertedId, includeDeleted)
+	} else {
+		// the past of a deleted product is hidden like the product itself,
+		// unless the caller is an admin
+		if !h.isAdmin(r) {
+			_, err = h.Repo.GetProductByID(r.Context(), convertedId)
+		}
+		if err == nil {
+			getProduct, err = h.Repo.GetProductAsOf(r.Context(), convertedId, asOf)
+		}
+	}
+	if err != nil {
+		RepositoryError(w, err, "could not retrieve product")
+		return
+	}
+
+	writeCacheable(w, r, getProduct, getProduct.UpdatedAt)
+}
+
+// getProduct reads a product, even a deleted one when includeDeleted is set.
+func (h *ProductHandler) getProduct(ctx context.Context, id int64, includeDeleted bool) (models.Product, error) {
+	if !includeDeleted {
+		return h.Repo.GetProductByID(ctx, id)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(getProduct)
+	page, err := h.Repo.ListProducts(ctx, repository.ListOptions{
+		Limit:  1,
+		Filter: repository.ProductFilter{IDs: []int64{id}, IncludeDeleted: true},
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+	if len(page.Products) == 0 {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
+	}
+	return page.Products[0], nil
 }
 
 // DELETE
@@ -79,22 +169,16 @@ func (h *ProductHandler) DeleteProductByID(w http.ResponseWriter, r *http.Reques
 
 	convertedId, err := strconv.ParseInt(productID, 10, 64)
 	if err != nil {
-		ResponseError(w, "invalid product ID", http.StatusBadRequest)
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
 		return
 	}
 
-	err = h.Repo.DeleteProductByID(convertedId)
+	err = h.Repo.DeleteProductByID(r.Context(), convertedId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ResponseError(w, "Product not found", http.StatusNotFound)
-		} else {
-			ResponseError(w, "could not delete product", http.StatusInternalServerError)
-		}
+		RepositoryError(w, err, "could not delete product")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
+	respond(w, http.StatusOK, map[string]string{"message": "Product deleted successfully"})
 }
 
 // PUT
@@ -104,40 +188,336 @@ func (h *ProductHandler) UpdateProductByID(w http.ResponseWriter, r *http.Reques
 
 	convertedId, err := strconv.ParseInt(productID, 10, 64)
 	if err != nil {
-		ResponseError(w, "invalid request payload", http.StatusBadRequest)
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid request payload")
 		return
 	}
 
 	var updateProduct models.Product
-	if err = json.NewDecoder(r.Body).Decode(&updateProduct); err != nil {
-		ResponseError(w, "Could not update product", http.StatusInternalServerError)
+	if !decodeBody(w, r, &updateProduct, maxBodySize) {
+		return
+	}
+	if err := validateProduct(updateProduct); err != nil {
+		validationProblem(w, http.StatusBadRequest, err.Error(), err, "")
 		return
 	}
 
-	err = h.Repo.UpdateProductByID(convertedId, updateProduct)
+	// a version sent in the body makes the update conditional as well, but
+	// If-Match takes precedence
+	if r.Header.Get("If-Match") != "" {
+		current, err := h.Repo.GetProductByID(r.Context(), convertedId)
+		if err != nil {
+			RepositoryError(w, err, "could not update product")
+			return
+		}
+		if !checkIfMatch(w, r, current) {
+			return
+		}
+		updateProduct.Version = current.Version
+	}
+
+	err = h.Repo.UpdateProductByID(r.Context(), convertedId, updateProduct)
 	if err != nil {
-		if err.Error() == "product not found" {
-			ResponseError(w, "Product not found", http.StatusNotFound)
-		} else {
-			ResponseError(w, "could not update product", http.StatusInternalServerError)
+		RepositoryError(w, err, "could not update product")
+		return
+	}
+
+	respond(w, http.StatusOK, map[string]string{"message": "Product updated successfully"})
+}
+
+// GET BY SKU
+func (h *ProductHandler) GetProductBySKU(w http.ResponseWriter, r *http.Request) {
+	product, err := h.Repo.GetProductBySKU(r.Context(), mux.Vars(r)["sku"])
+	if err != nil {
+		RepositoryError(w, err, "could not retrieve product")
+		return
+	}
+
+	writeCacheable(w, r, product, product.UpdatedAt)
+}
+
+// PUT BY SKU replaces the product with the SKU of the URL, or creates it
+// with 201 Created when there is none.
+func (h *ProductHandler) UpsertProductBySKU(w http.ResponseWriter, r *http.Request) {
+	sku := mux.Vars(r)["sku"]
+
+	var product models.Product
+	if !decodeBody(w, r, &product, maxBodySize) {
+		return
+	}
+	if product.SKU != "" && product.SKU != sku {
+		writeProblem(w, models.Problem{Status: http.StatusUnprocessableEntity, Code: CodeImmutableField, Detail: "Product SKU must be the one in the URL",
+			Errors: []models.FieldError{{Field: "/sku", Code: CodeImmutableField, Message: "SKU must be the one in the URL"}}})
+		return
+	}
+	product.SKU = sku
+	if err := validateProduct(product); err != nil {
+		validationProblem(w, http.StatusBadRequest, err.Error(), err, "")
+		return
+	}
+
+	// If-Match only replaces the product at the version it names, so a
+	// missing product fails it
+	if r.Header.Get("If-Match") != "" {
+		current, err := h.Repo.GetProductBySKU(r.Context(), sku)
+		if errors.Is(err, repository.ErrNotFound) {
+			Problem(w, http.StatusPreconditionFailed, CodePreconditionFailed, "Product does not match If-Match")
+			return
+		} else if err != nil {
+			RepositoryError(w, err, "could not update product")
+			return
+		}
+		if !checkIfMatch(w, r, current) {
+			return
 		}
+		product.Version = current.Version
+	}
+
+	result, created, err := h.Repo.UpsertProductBySKU(r.Context(), sku, product)
+	if err != nil {
+		RepositoryError(w, err, "could not update product")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Product updated successfully"})
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", "/products/"+strconv.FormatInt(result.ID, 10))
+	}
+	w.Header().Set("ETag", ETag(result))
+	respond(w, status, result)
+}
+
+// PRICES
+func (h *ProductHandler) GetProductPrices(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID := vars["id"]
+
+	convertedId, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
+		return
+	}
+
+	prices, err := h.Repo.ListProductPrices(r.Context(), convertedId)
+	if err != nil {
+		RepositoryError(w, err, "could not list product prices")
+		return
+	}
+
+	respond(w, http.StatusOK, prices)
+}
+
+// HISTORY
+func (h *ProductHandler) GetProductHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID := vars["id"]
+
+	convertedId, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
+		return
+	}
+
+	opts, err := parseHistoryOptions(r.URL.Query())
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	page, err := h.Repo.ListProductHistory(r.Context(), convertedId, opts)
+	if err != nil {
+		RepositoryError(w, err, "could not list product history")
+		return
+	}
+
+	if page.Next != 0 {
+		setNextPage(w, r, strconv.FormatInt(page.Next, 10))
+	}
+	respond(w, http.StatusOK, page.Entries)
+}
+
+// RESTORE brings a deleted product back into view, so like listing deleted
+// products it is for admins only.
+func (h *ProductHandler) RestoreProductByID(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID := vars["id"]
+
+	convertedId, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
+		return
+	}
+
+	restored, err := h.Repo.RestoreProductByID(r.Context(), convertedId)
+	if err != nil {
+		RepositoryError(w, err, "could not restore product")
+		return
+	}
+
+	w.Header().Set("ETag", ETag(restored))
+	respond(w, http.StatusOK, restored)
+}
+
+// PATCH
+func (h *ProductHandler) PatchProductByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID := vars["id"]
+
+	convertedId, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidProductID, "invalid product ID")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonpatch.MergePatchType && mediaType != jsonpatch.JSONPatchType {
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		Problem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be "+jsonpatch.MergePatchType+" or "+jsonpatch.JSONPatchType)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Problem(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("A patch is limited to %d bytes", maxPatchSize))
+		return
+	} else if err != nil {
+		Problem(w, http.StatusBadRequest, CodeMalformedBody, "Could not read the patch")
+		return
+	}
+
+	current, err := h.Repo.GetProductByID(r.Context(), convertedId)
+	if err != nil {
+		RepositoryError(w, err, "could not retrieve product")
+		return
+	}
+	if !checkIfMatch(w, r, current) {
+		return
+	}
+
+	doc, _ := json.Marshal(current)
+	var patched []byte
+	if mediaType == jsonpatch.MergePatchType {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		patched, err = jsonpatch.Apply(doc, patch)
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		Problem(w, http.StatusConflict, CodePatchTestFailed, err.Error())
+		return
+	case errors.Is(err, jsonpatch.ErrCannotApply):
+		Problem(w, http.StatusUnprocessableEntity, CodeInvalidPatch, err.Error())
+		return
+	case err != nil:
+		Problem(w, http.StatusBadRequest, CodeInvalidPatch, err.Error())
+		return
+	}
+
+	var updated models.Product
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		Problem(w, http.StatusUnprocessableEntity, CodeInvalidPatch, "Patched product is invalid: "+err.Error())
+		return
+	}
+	if updated.ID != current.ID {
+		writeProblem(w, models.Problem{Status: http.StatusUnprocessableEntity, Code: CodeImmutableField, Detail: "Product ID cannot be changed",
+			Errors: []models.FieldError{{Field: "/id", Code: CodeImmutableField, Message: "ID cannot be changed"}}})
+		return
+	}
+	if updated.Version != current.Version {
+		writeProblem(w, models.Problem{Status: http.StatusUnprocessableEntity, Code: CodeImmutableField, Detail: "Product version cannot be changed",
+			Errors: []models.FieldError{{Field: "/version", Code: CodeImmutableField, Message: "Version cannot be changed"}}})
+		return
+	}
+	if err := validateProduct(updated); err != nil {
+		validationProblem(w, http.StatusBadRequest, err.Error(), err, "")
+		return
+	}
+
+	// only the columns that really changed are written, and only if nobody
+	// updated the product since it was read
+	changes := repository.ProductChanges{Version: current.Version}
+	if updated.SKU != current.SKU {
+		changes.SKU = &updated.SKU
+	}
+	if updated.Name != current.Name {
+		changes.Name = &updated.Name
+	}
+	if updated.Price != current.Price {
+		changes.Price = &updated.Price
+	}
+
+	result, err := h.Repo.PatchProductByID(r.Context(), convertedId, changes)
+	if err != nil {
+		RepositoryError(w, err, "could not update product")
+		return
+	}
+
+	w.Header().Set("ETag", ETag(result))
+	respond(w, http.StatusOK, result)
 }
 
 // GET ALL
 func (h *ProductHandler) GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	list, err := h.Repo.GetAllProducts()
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	if opts.Filter.IncludeDeleted && !h.requireAdmin(w, r) {
+		return
+	}
+
+	page, err := h.Repo.ListProducts(r.Context(), opts)
+	if err != nil {
+		RepositoryError(w, err, "could not list products")
+		return
+	}
+
+	setPageHeaders(w, r, page)
+	// no Last-Modified: deleting a product changes the page without changing
+	// the update time of the products left in it
+	writeCacheable(w, r, page.Products, time.Time{})
+}
+
+// SEARCH
+func (h *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := checkParameters(query, searchParameters); err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	q := repository.SearchQuery{Text: query.Get("q"), Limit: DefaultSearchSize}
+	if len(repository.SearchTerms(q.Text)) == 0 {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, "q must contain at least one word")
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			Problem(w, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("limit must be between 1 and %d", MaxPageSize))
+			return
+		}
+		q.Limit = limit
+	}
+
+	results, err := h.Repo.SearchProducts(r.Context(), q)
 	if err != nil {
-		ResponseError(w, "no products found", http.StatusNotFound)
+		RepositoryError(w, err, "could not search products")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(list)
+	respond(w, http.StatusOK, results)
 }
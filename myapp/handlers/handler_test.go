@@ -2,7 +2,7 @@ package handlers_test
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,15 +12,20 @@ import (
 
 	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
 	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
 	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
 	"github.com/gorilla/mux"
 )
 
+func usd(amount string) money.Money {
+	return money.MustParse(amount, "USD")
+}
+
 // ****** CREATE ******
 func TestCreateProduct_Success(t *testing.T) {
 	//simulando a função InsertProduct
 	mockRepo := &repository.MockManualProductRepository{
-		InsertProductFunc: func(p models.Product) (int64, error) {
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
 			//define o que a função irá retornar, simula o acesso ao banco de dados, nesse caso, sucesso
 			return 1, nil
 		},
@@ -30,7 +35,7 @@ func TestCreateProduct_Success(t *testing.T) {
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
 	//criando o produto da requisição
-	product := models.Product{Name: "Test Product", Price: 10}
+	product := models.Product{Name: "Test Product", Price: usd("10")}
 	//mudando ele para formato json, para ser o r.body
 	body, _ := json.Marshal(product)
 	//cria uma nova requisição do tipo POST para o endpoint /products
@@ -55,14 +60,14 @@ func TestCreateProduct_Success(t *testing.T) {
 
 func TestCreateProduct_InvalidPrice(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		InsertProductFunc: func(p models.Product) (int64, error) {
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
 			return 1, nil
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "Test Product", Price: 0}
+	product := models.Product{Name: "Test Product", Price: usd("0")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -74,7 +79,7 @@ func TestCreateProduct_InvalidPrice(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Price must be greater than 0","errorCode":400}`
+	expectedResponse := `{"type":"/problems/validation_failed","title":"Validation failed","status":400,"detail":"Price must be greater than 0","code":"validation_failed","errors":[{"field":"/price/amount","code":"not_positive","message":"Price must be greater than 0"}]}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected body %s, got %s", expectedResponse, rr.Body.String())
 	}
@@ -82,14 +87,14 @@ func TestCreateProduct_InvalidPrice(t *testing.T) {
 
 func TestCreateProduct_InvalidName(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		InsertProductFunc: func(p models.Product) (int64, error) {
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
 			return 1, nil
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "", Price: 10}
+	product := models.Product{Name: "", Price: usd("10")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -101,22 +106,41 @@ func TestCreateProduct_InvalidName(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Name is required","errorCode":400}`
+	expectedResponse := `{"type":"/problems/validation_failed","title":"Validation failed","status":400,"detail":"Name is required","code":"validation_failed","errors":[{"field":"/name","code":"required","message":"Name is required"}]}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected body %s, got %s", expectedResponse, rr.Body.String())
 	}
 }
 
+func TestCreateProduct_BlankName(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			t.Fatalf("expected no insert, got %+v", p)
+			return 0, nil
+		},
+	}
+
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name":"   ","price":{"amount":"10","currency":"USD"}}`))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	if !strings.Contains(rr.Body.String(), `{"field":"/name","code":"blank","message":"Name must not be blank"}`) {
+		t.Errorf("expected a blank name error, got %s", rr.Body.String())
+	}
+}
+
 func TestCreateProduct_ServerError(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		InsertProductFunc: func(p models.Product) (int64, error) {
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
 			return 0, fmt.Errorf("database error")
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "Test Product", Price: 10.0}
+	product := models.Product{Name: "Test Product", Price: usd("10")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -127,17 +151,88 @@ func TestCreateProduct_ServerError(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, status)
 	}
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Could not insert the product","errorCode":500}`
+	expectedResponse := `{"type":"/problems/internal_error","title":"Internal error","status":500,"detail":"Could not insert the product","code":"internal_error"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected body %s, got %s", expectedResponse, actualResponse)
 	}
 }
 
+func TestCreateProduct_Conflict(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			return 0, fmt.Errorf("could not insert product: %w", repository.ErrConflict)
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+
+	product := models.Product{Name: "Test Product", Price: usd("10")}
+	body, _ := json.Marshal(product)
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.CreateProduct(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, status)
+	}
+	actualResponse := strings.TrimSpace(rr.Body.String())
+	expectedResponse := `{"type":"/problems/product_conflict","title":"Product conflict","status":409,"detail":"Product conflicts with an existing product","code":"product_conflict"}`
+	if actualResponse != expectedResponse {
+		t.Errorf("expected body %s, got %s", expectedResponse, actualResponse)
+	}
+}
+
+func TestCreateProduct_MalformedBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		detail string
+	}{
+		{"UnknownField", `{"name":"Tea","price":{"amount":"1","currency":"EUR"},"colour":"red"}`, http.StatusBadRequest,
+			`Malformed request body: line 1, column 55: unknown field "colour"`},
+		{"TrailingData", `{"name":"Tea","price":{"amount":"1","currency":"EUR"}}]`, http.StatusBadRequest,
+			"Malformed request body: line 1, column 55: invalid character ']' after top-level value"},
+		{"Syntax", `{"name":}`, http.StatusBadRequest,
+			"Malformed request body: line 1, column 9: invalid character '}' looking for beginning of value"},
+		{"TooLarge", `{"name":"` + strings.Repeat("x", 1<<20) + `"}`, http.StatusRequestEntityTooLarge,
+			"The request body is limited to 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockManualProductRepository{
+				InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+					t.Fatalf("expected no insert, got %+v", p)
+					return 0, nil
+				},
+			}
+
+			req, _ := http.NewRequest("POST", "/products", strings.NewReader(tt.body))
+			rr := serve(mockRepo, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			// a single problem, not followed by a validation error
+			var problem models.Problem
+			dec := json.NewDecoder(rr.Body)
+			if err := dec.Decode(&problem); err != nil || dec.More() {
+				t.Fatalf("expected a single problem, got %s", rr.Body.String())
+			}
+			if problem.Detail != tt.detail {
+				t.Errorf("expected detail %q, got %q", tt.detail, problem.Detail)
+			}
+		})
+	}
+}
+
 // ****** GET *******
 func TestGetProductByID_Success(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		GetProductByIDFunc: func(id int64) (models.Product, error) {
-			return models.Product{ID: 1, Name: "Test Product", Price: 10.0}, nil
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{ID: 1, Name: "Test Product", Price: usd("10")}, nil
 		},
 	}
 
@@ -154,7 +249,7 @@ func TestGetProductByID_Success(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusOK, status)
 	}
 
-	expectedProduct := models.Product{ID: 1, Name: "Test Product", Price: 10.0}
+	expectedProduct := models.Product{ID: 1, Name: "Test Product", Price: usd("10")}
 	var actualProduct models.Product
 	if err := json.NewDecoder(rr.Body).Decode(&actualProduct); err != nil {
 		t.Fatalf("failed to decode response %v", err)
@@ -167,8 +262,8 @@ func TestGetProductByID_Success(t *testing.T) {
 
 func TestGetProductByID_NotFound(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		GetProductByIDFunc: func(id int64) (models.Product, error) {
-			return models.Product{}, nil
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
 		},
 	}
 
@@ -186,7 +281,7 @@ func TestGetProductByID_NotFound(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Product not found","errorCode":404}`
+	expectedResponse := `{"type":"/problems/product_not_found","title":"Product not found","status":404,"detail":"Product not found","code":"product_not_found"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
@@ -194,7 +289,7 @@ func TestGetProductByID_NotFound(t *testing.T) {
 
 func TestGetProductByID_ServerError(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		GetProductByIDFunc: func(id int64) (models.Product, error) {
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
 			return models.Product{}, fmt.Errorf("could not retrieve product")
 		},
 	}
@@ -213,16 +308,70 @@ func TestGetProductByID_ServerError(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"could not retrieve product","errorCode":500}`
+	expectedResponse := `{"type":"/problems/internal_error","title":"Internal error","status":500,"detail":"could not retrieve product","code":"internal_error"}`
+	if actualResponse != expectedResponse {
+		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
+	}
+}
+
+func TestGetProductByID_Unavailable(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{}, fmt.Errorf("could not retrieve product: %w", repository.ErrUnavailable)
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+
+	req, _ := http.NewRequest("GET", "/products/1", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/{id}", handler.GetProductByID).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, status)
+	}
+
+	actualResponse := strings.TrimSpace(rr.Body.String())
+	expectedResponse := `{"type":"/problems/service_unavailable","title":"Service unavailable","status":503,"detail":"Service temporarily unavailable","code":"service_unavailable"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
 }
 
+func TestGetProductByID_UsesRequestContext(t *testing.T) {
+	type ctxKey struct{}
+
+	mockRepo := &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			if ctx.Value(ctxKey{}) != "request" {
+				t.Errorf("expected the request context to reach the repository")
+			}
+			return models.Product{ID: id, Name: "Test Product", Price: usd("10")}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/products/1", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/{id}", handler.GetProductByID).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, status)
+	}
+}
+
 // ****** DELETE *******
 func TestDeleteProductByID_Success(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		DeleteProductByIDFunc: func(id int64) error { return nil },
+		DeleteProductByIDFunc: func(ctx context.Context, id int64) error { return nil },
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
@@ -247,8 +396,8 @@ func TestDeleteProductByID_Success(t *testing.T) {
 
 func TestDeleteProductByID_NotFound(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		DeleteProductByIDFunc: func(id int64) error {
-			return sql.ErrNoRows
+		DeleteProductByIDFunc: func(ctx context.Context, id int64) error {
+			return fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
 		},
 	}
 
@@ -266,7 +415,7 @@ func TestDeleteProductByID_NotFound(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Product not found","errorCode":404}`
+	expectedResponse := `{"type":"/problems/product_not_found","title":"Product not found","status":404,"detail":"Product not found","code":"product_not_found"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
@@ -274,7 +423,7 @@ func TestDeleteProductByID_NotFound(t *testing.T) {
 
 func TestDeleteProductByID_ServerError(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		DeleteProductByIDFunc: func(id int64) error {
+		DeleteProductByIDFunc: func(ctx context.Context, id int64) error {
 			return fmt.Errorf("could not delete product")
 		},
 	}
@@ -293,7 +442,7 @@ func TestDeleteProductByID_ServerError(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"could not delete product","errorCode":500}`
+	expectedResponse := `{"type":"/problems/internal_error","title":"Internal error","status":500,"detail":"could not delete product","code":"internal_error"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
@@ -302,14 +451,14 @@ func TestDeleteProductByID_ServerError(t *testing.T) {
 // ****** UPDATE *******
 func TestUpdateProductByID_Success(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		UpdateProductByIDFunc: func(id int64, p models.Product) error {
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
 			return nil
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "New name", Price: 10}
+	product := models.Product{Name: "New name", Price: usd("10")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -331,14 +480,14 @@ func TestUpdateProductByID_Success(t *testing.T) {
 
 func TestUpdateProductByID_NotFound(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		UpdateProductByIDFunc: func(id int64, p models.Product) error {
-			return fmt.Errorf("product not found")
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+			return fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "non-existent name", Price: 10}
+	product := models.Product{Name: "non-existent name", Price: usd("10")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -352,7 +501,7 @@ func TestUpdateProductByID_NotFound(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"Product not found","errorCode":404}`
+	expectedResponse := `{"type":"/problems/product_not_found","title":"Product not found","status":404,"detail":"Product not found","code":"product_not_found"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
@@ -360,14 +509,14 @@ func TestUpdateProductByID_NotFound(t *testing.T) {
 
 func TestUpdateProductByID_ServerError(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		UpdateProductByIDFunc: func(id int64, p models.Product) error {
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
 			return fmt.Errorf("internal server error")
 		},
 	}
 
 	handler := handlers.ProductHandler{Repo: mockRepo}
 
-	product := models.Product{Name: "Test name", Price: 10}
+	product := models.Product{Name: "Test name", Price: usd("10")}
 	body, _ := json.Marshal(product)
 	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBuffer(body))
 	rr := httptest.NewRecorder()
@@ -381,19 +530,64 @@ func TestUpdateProductByID_ServerError(t *testing.T) {
 	}
 
 	actualResponse := strings.TrimSpace(rr.Body.String())
-	expectedResponse := `{"error":"could not update product","errorCode":500}`
+	expectedResponse := `{"type":"/problems/internal_error","title":"Internal error","status":500,"detail":"could not update product","code":"internal_error"}`
 	if actualResponse != expectedResponse {
 		t.Errorf("expected product %v, got %v", expectedResponse, actualResponse)
 	}
 }
 
+func TestUpdateProductByID_Invalid(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+			t.Fatalf("expected no update, got %+v", p)
+			return nil
+		},
+	}
+
+	body := `{"name":"` + strings.Repeat("x", 201) + `","price":{"amount":"-1","currency":"EUR"},"version":-2}`
+	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	var problem models.Problem
+	json.NewDecoder(rr.Body).Decode(&problem)
+	var fields []string
+	for _, e := range problem.Errors {
+		fields = append(fields, e.Field+" "+e.Code)
+	}
+	if got := strings.Join(fields, ", "); got != "/name too_long, /version too_small, /price/amount not_positive" {
+		t.Errorf("expected every invalid field, got %s", got)
+	}
+}
+
+func TestUpdateProductByID_MalformedBody(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+			t.Fatalf("expected no update, got %+v", p)
+			return nil
+		},
+	}
+
+	req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBufferString(`{"name":"Tea","id":"1"}`))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	if !strings.Contains(rr.Body.String(), `"code":"malformed_body"`) {
+		t.Errorf("expected a malformed body problem, got %s", rr.Body.String())
+	}
+}
+
 func TestGetAll_Success(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		GetAllProductsFunc: func() (sp []models.Product, err error) {
-			return []models.Product{
-				{ID: 1, Name: "Product 1", Price: 10.0},
-				{ID: 2, Name: "Product 2", Price: 15.0},
-			}, nil
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			return repository.ProductPage{Products: []models.Product{
+				{ID: 1, Name: "Product 1", Price: usd("10")},
+				{ID: 2, Name: "Product 2", Price: usd("15")},
+			}, Total: 2}, nil
 		},
 	}
 
@@ -409,17 +603,45 @@ func TestGetAll_Success(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusOK, status)
 	}
 
-	expectedResponse := `[{"id":1,"name":"Product 1","price":10},{"id":2,"name":"Product 2","price":15}]`
+	var products []models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&products); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(products) != 2 || products[0].Name != "Product 1" || products[1].Name != "Product 2" {
+		t.Errorf("unexpected products %v", products)
+	}
+}
+
+func TestGetAll_Empty(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			return repository.ProductPage{Products: []models.Product{}}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	req, _ := http.NewRequest("GET", "/products", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products", handler.GetAllProducts).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	expectedResponse := `[]`
 	actualResponse := strings.TrimSpace(rr.Body.String())
 	if actualResponse != expectedResponse {
 		t.Errorf("expected body %s, got %s", expectedResponse, actualResponse)
 	}
 }
 
-func TestGetAll_NotFound(t *testing.T) {
+func TestGetAll_ServerError(t *testing.T) {
 	mockRepo := &repository.MockManualProductRepository{
-		GetAllProductsFunc: func() (sp []models.Product, err error) {
-			return []models.Product{}, fmt.Errorf("no products found")
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			return repository.ProductPage{}, fmt.Errorf("database error")
 		},
 	}
 
@@ -431,13 +653,56 @@ func TestGetAll_NotFound(t *testing.T) {
 	router.HandleFunc("/products", handler.GetAllProducts).Methods("GET")
 	router.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusNotFound {
-		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, status)
 	}
 
-	expectedResponse := `{"error":"no products found","errorCode":404}`
+	expectedResponse := `{"type":"/problems/internal_error","title":"Internal error","status":500,"detail":"could not list products","code":"internal_error"}`
 	actualResponse := strings.TrimSpace(rr.Body.String())
 	if actualResponse != expectedResponse {
 		t.Errorf("expected body %s, got %s", expectedResponse, actualResponse)
 	}
 }
+
+func TestProductLifecycle_MemoryRepository(t *testing.T) {
+	handler := handlers.ProductHandler{Repo: repository.NewMemoryProductRepository()}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products", handler.CreateProduct).Methods("POST")
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+	router.HandleFunc("/products/{id}", handler.GetProductByID).Methods("GET")
+	router.HandleFunc("/products/{id}", handler.DeleteProductByID).Methods("DELETE")
+
+	body, _ := json.Marshal(models.Product{Name: "Test Product", Price: usd("10")})
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("create: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	req, _ = http.NewRequest("GET", "/products/list", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var products []models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&products); err != nil {
+		t.Fatalf("list: failed to decode response %v", err)
+	}
+	if len(products) != 1 || products[0].ID != 1 || products[0].Name != "Test Product" || products[0].Version != 1 || products[0].CreatedAt.IsZero() {
+		t.Errorf("list: unexpected products %v", products)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/products/1", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("delete: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	req, _ = http.NewRequest("GET", "/products/1", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("get after delete: expected status code %d, got %d", http.StatusNotFound, status)
+	}
+}
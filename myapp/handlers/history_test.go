@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func TestGetProductHistory_Success(t *testing.T) {
+	var received repository.HistoryOptions
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductHistoryFunc: func(ctx context.Context, id int64, opts repository.HistoryOptions) (repository.HistoryPage, error) {
+			received = opts
+			return repository.HistoryPage{Entries: []models.AuditEntry{
+				{ID: 9, ProductID: id, Action: audit.ActionUpdate, Actor: "alice"},
+				{ID: 7, ProductID: id, Action: audit.ActionCreate, Actor: "bob"},
+			}, Next: 7}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1/history?limit=2&after=12", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveAdmin(mockRepo, "s3cret", req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if received.Limit != 2 || received.After != 12 {
+		t.Errorf("unexpected history options %+v", received)
+	}
+	if cursor := rr.Header().Get("X-Next-Cursor"); cursor != "7" {
+		t.Errorf("expected next cursor 7, got %q", cursor)
+	}
+	if link := rr.Header().Get("Link"); !strings.Contains(link, "after=7") {
+		t.Errorf("expected a link to the next page, got %q", link)
+	}
+
+	var entries []models.AuditEntry
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(entries) != 2 || entries[0].Actor != "alice" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestGetProductHistory_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		status        int
+	}{
+		{"NoToken", "/products/1/history", "", http.StatusUnauthorized},
+		{"WrongToken", "/products/1/history", "Bearer guess", http.StatusForbidden},
+		{"InvalidID", "/products/abc/history", "Bearer s3cret", http.StatusBadRequest},
+		{"InvalidCursor", "/products/1/history?after=abc", "Bearer s3cret", http.StatusBadRequest},
+		{"InvalidLimit", "/products/1/history?limit=0", "Bearer s3cret", http.StatusBadRequest},
+		{"UnknownParameter", "/products/1/history?sort=id", "Bearer s3cret", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := serveAdmin(&repository.MockManualProductRepository{}, "s3cret", req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	var received audit.Info
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			received = audit.FromContext(ctx)
+			return 1, nil
+		},
+	}
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		actor     string
+		claimed   string
+		requestID string
+	}{
+		{"Anonymous", nil, handlers.AnonymousActor, "", ""},
+		{"ForwardedActor", map[string]string{"X-Actor": "alice", handlers.ProxyTokenHeader: "pr0xy", "X-Request-ID": "req-42"}, "alice", "", "req-42"},
+		{"ClaimedActor", map[string]string{"X-Actor": "alice"}, handlers.AnonymousActor, "alice", ""},
+		{"WrongProxyToken", map[string]string{"X-Actor": "alice", handlers.ProxyTokenHeader: "guess"}, handlers.AnonymousActor, "alice", ""},
+		{"Admin", map[string]string{"Authorization": "Bearer s3cret", "X-Actor": "alice"}, handlers.AdminActor, "", ""},
+		{"InvalidHeaders", map[string]string{"X-Actor": "two words", handlers.ProxyTokenHeader: "pr0xy", "X-Request-ID": strings.Repeat("x", 200)}, handlers.AnonymousActor, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name":"Product","price":{"amount":"1","currency":"USD"}}`))
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := serveHandler(&handlers.ProductHandler{Repo: mockRepo, AdminToken: "s3cret", ProxyToken: "pr0xy"}, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+			if received.Actor != tt.actor || received.ClaimedActor != tt.claimed {
+				t.Errorf("expected actor %q claiming %q, got %q claiming %q", tt.actor, tt.claimed, received.Actor, received.ClaimedActor)
+			}
+			requestID := rr.Header().Get("X-Request-ID")
+			if received.RequestID != requestID || requestID == "" {
+				t.Errorf("expected request ID %q to be echoed, got %q", received.RequestID, requestID)
+			}
+			if tt.requestID != "" && requestID != tt.requestID {
+				t.Errorf("expected request ID %q, got %q", tt.requestID, requestID)
+			}
+		})
+	}
+}
+
+func TestProductHistory_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	handler := &handlers.ProductHandler{Repo: repo, AdminToken: "s3cret", ProxyToken: "pr0xy"}
+
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(`{"name":"Product","price":{"amount":"1","currency":"USD"}}`))
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set(handlers.ProxyTokenHeader, "pr0xy")
+	serveHandler(handler, req)
+
+	// without the proxy token, bob is only claimed
+	req, _ = http.NewRequest("PUT", "/products/1", bytes.NewBufferString(`{"name":"Product","price":{"amount":"2","currency":"USD"}}`))
+	req.Header.Set("X-Actor", "bob")
+	serveHandler(handler, req)
+
+	req, _ = http.NewRequest("GET", "/products/1/history", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := serveHandler(handler, req)
+
+	var entries []models.AuditEntry
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(entries) != 2 || entries[0].Actor != handlers.AnonymousActor || entries[0].ClaimedActor != "bob" || entries[0].Before.Price != usd("1") || entries[0].After.Price != usd("2") || entries[1].Actor != "alice" {
+		t.Errorf("unexpected history %+v", entries)
+	}
+}
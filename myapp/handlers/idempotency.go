@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/idempotency"
+)
+
+// IdempotencyKeyHeader names the header a client sets to make a request safe
+// to retry. A replayed response carries IdempotentReplayedHeader.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// recordingWriter keeps a copy of the response it writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotencyScope tells apart the clients whose keys must never meet. An
+// actor is authenticated, but every anonymous client shares one actor, so
+// anonymous keys are scoped to the client address as well. Clients behind a
+// proxy that does not send the proxy token share its address, and with it
+// their keys. Neither actors nor addresses contain spaces, so two scopes
+// never meet.
+func idempotencyScope(r *http.Request) string {
+	actor := audit.FromContext(r.Context()).Actor
+	if actor != AnonymousActor {
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return actor + " " + host
+}
+
+// idempotent runs next once per Idempotency-Key. The response to the first
+// request with a key is stored with a fingerprint of the request, and sent
+// again for any retry of that request. Keys are scoped to the actor, or for
+// anonymous requests to the client address, see idempotencyScope, and
+// requests without a key are served as usual. Server errors are not stored,
+// so that the request can be retried.
+func (h *ProductHandler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if h.Idempotency == nil || key == "" {
+			next(w, r)
+			return
+		}
+		if !validHeaderID(key) {
+			Problem(w, http.StatusBadRequest, CodeInvalidIdempotencyKey,
+				fmt.Sprintf("%s must be 1 to %d printable ASCII characters", IdempotencyKeyHeader, maxHeaderIDLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			Problem(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("The request body is limited to %d bytes", maxBodySize))
+			return
+		} else if err != nil {
+			Problem(w, http.StatusBadRequest, CodeMalformedBody, "Could not read the request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scoped := idempotencyScope(r) + " " + key
+		stored, err := h.Idempotency.Begin(r.Context(), scoped, idempotency.Fingerprint(r.Method, r.URL.Path, body))
+		switch {
+		case errors.Is(err, idempotency.ErrMismatch):
+			Problem(w, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, IdempotencyKeyHeader+" was already used for another request")
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			Problem(w, http.StatusConflict, CodeIdempotencyKeyInProgress, "A request with this "+IdempotencyKeyHeader+" is still in progress")
+			return
+		case err != nil:
+			Problem(w, http.StatusInternalServerError, CodeInternalError, "could not check the idempotency key")
+			return
+		case stored != nil:
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// the recorder goes under the negotiated writer, which the helpers
+		// writing the response look for
+		rec := &recordingWriter{ResponseWriter: w}
+		var out http.ResponseWriter = rec
+		if nw, ok := w.(*negotiatedWriter); ok {
+			recorded := *nw
+			rec.ResponseWriter = nw.ResponseWriter
+			recorded.ResponseWriter = rec
+			out = &recorded
+		}
+		next(out, r)
+
+		// the response is stored even if the client went away meanwhile,
+		// since that client is the one about to retry
+		ctx := context.Background()
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			if err := h.Idempotency.Release(ctx, scoped); err != nil {
+				log.Printf("Could not release idempotency key %q: %v", key, err)
+			}
+			return
+		}
+		header := rec.Header().Clone()
+		header.Del("X-Request-ID")
+		resp := idempotency.Response{Status: rec.status, Header: header, Body: rec.body.Bytes()}
+		if err := h.Idempotency.Complete(ctx, scoped, resp); err != nil {
+			log.Printf("Could not store the response for idempotency key %q: %v", key, err)
+			h.Idempotency.Release(ctx, scoped)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/idempotency"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+// countingRepo inserts products with increasing IDs, or fails with err.
+func countingRepo(inserts *int, err *error) *repository.MockManualProductRepository {
+	return &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			if *err != nil {
+				return 0, *err
+			}
+			*inserts++
+			return int64(*inserts), nil
+		},
+	}
+}
+
+func createRequest(key, actor, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/products", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+	}
+	if actor != "" {
+		req.Header.Set("X-Actor", actor)
+		req.Header.Set(handlers.ProxyTokenHeader, "pr0xy")
+	}
+	return req
+}
+
+const teaBody = `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`
+
+func TestCreateProduct_IdempotencyKeyReplay(t *testing.T) {
+	var inserts int
+	var err error
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour)}
+
+	first := serveHandler(handler, createRequest("abc", "", teaBody))
+	retry := serveHandler(handler, createRequest("abc", "", teaBody))
+
+	if inserts != 1 {
+		t.Errorf("expected a single insert, got %d", inserts)
+	}
+	if first.Code != http.StatusOK || retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response again, got %d %s then %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get(handlers.IdempotentReplayedHeader) != "true" || first.Header().Get(handlers.IdempotentReplayedHeader) != "" {
+		t.Errorf("expected only the retry to be marked as replayed")
+	}
+	if retry.Header().Get("Content-Type") != "application/json" || retry.Header().Get("X-Request-ID") == first.Header().Get("X-Request-ID") {
+		t.Errorf("unexpected replayed headers %v", retry.Header())
+	}
+}
+
+func TestCreateProduct_IdempotencyKeyReuse(t *testing.T) {
+	var inserts int
+	var err error
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour)}
+
+	serveHandler(handler, createRequest("abc", "", teaBody))
+	rr := serveHandler(handler, createRequest("abc", "", `{"name":"Milk","price":{"amount":"1","currency":"EUR"}}`))
+
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), `"code":"idempotency_key_reused"`) {
+		t.Errorf("expected a 422 for a reused key, got %d %s", rr.Code, rr.Body.String())
+	}
+	if inserts != 1 {
+		t.Errorf("expected a single insert, got %d", inserts)
+	}
+}
+
+func TestCreateProduct_IdempotencyKeyScope(t *testing.T) {
+	var inserts int
+	var err error
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour), ProxyToken: "pr0xy"}
+
+	serveHandler(handler, createRequest("", "", teaBody))
+	serveHandler(handler, createRequest("", "", teaBody))
+	serveHandler(handler, createRequest("abc", "alice", teaBody))
+	serveHandler(handler, createRequest("abc", "bob", teaBody))
+
+	if inserts != 4 {
+		t.Errorf("expected requests without a key or from other actors to be served, got %d inserts", inserts)
+	}
+}
+
+func TestCreateProduct_IdempotencyKeyAnonymousScope(t *testing.T) {
+	var inserts int
+	var err error
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour)}
+
+	send := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		req := createRequest("abc", "", body)
+		req.RemoteAddr = remoteAddr
+		return serveHandler(handler, req)
+	}
+	first := send("192.0.2.1:1234", teaBody)
+	// another anonymous client neither gets the stored response nor a
+	// mismatch for the same key
+	if rr := send("192.0.2.2:1234", `{"name":"Milk","price":{"amount":"1","currency":"EUR"}}`); rr.Code != http.StatusOK || rr.Body.String() == first.Body.String() {
+		t.Errorf("expected another anonymous client to be served, got %d %s", rr.Code, rr.Body.String())
+	}
+	// the same client retries from another port
+	if rr := send("192.0.2.1:5678", teaBody); rr.Header().Get(handlers.IdempotentReplayedHeader) != "true" || rr.Body.String() != first.Body.String() {
+		t.Errorf("expected the retry to be replayed, got %d %s", rr.Code, rr.Body.String())
+	}
+	if inserts != 2 {
+		t.Errorf("expected 2 inserts, got %d", inserts)
+	}
+}
+
+func TestCreateProduct_IdempotencyKeyServerError(t *testing.T) {
+	var inserts int
+	err := fmt.Errorf("connection refused")
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour)}
+
+	if rr := serveHandler(handler, createRequest("abc", "", teaBody)); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	err = nil
+	rr := serveHandler(handler, createRequest("abc", "", teaBody))
+	if rr.Code != http.StatusOK || rr.Header().Get(handlers.IdempotentReplayedHeader) != "" || inserts != 1 {
+		t.Errorf("expected the retry of a server error to be served, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCreateProduct_InvalidIdempotencyKey(t *testing.T) {
+	var inserts int
+	var err error
+	handler := &handlers.ProductHandler{Repo: countingRepo(&inserts, &err), Idempotency: idempotency.NewMemoryStore(time.Hour)}
+
+	rr := serveHandler(handler, createRequest(strings.Repeat("k", 200), "", teaBody))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"code":"invalid_idempotency_key"`) || inserts != 0 {
+		t.Errorf("expected a 400 for an invalid key, got %d %s", rr.Code, rr.Body.String())
+	}
+}
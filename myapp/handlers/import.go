@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+// MaxImportRows caps the number of products of an import.
+const MaxImportRows = 100000
+
+// maxImportSize caps the size of an import body.
+const maxImportSize = 64 << 20
+
+// maxImportLine caps the length of an NDJSON line.
+const maxImportLine = 1 << 20
+
+// importColumns are the columns an imported CSV must have.
+var importColumns = []string{"name", "price", "currency"}
+
+// optionalImportColumns are the columns an imported CSV may have.
+var optionalImportColumns = []string{"sku"}
+
+var errTooManyRows = fmt.Errorf("An import accepts at most %d products", MaxImportRows)
+
+// importRow receives each line of an import with the product read from it,
+// or the reason it could not be read.
+type importRow func(line int, p models.Product, err error) error
+
+// readCSV reads products from CSV whose header names the columns name, price
+// and currency, and optionally sku, in any order.
+func readCSV(body io.Reader, row importRow) error {
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return errors.New("A CSV import needs a header row")
+	} else if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return fmt.Errorf("CSV column %q is repeated", name)
+		}
+		columns[name] = i
+	}
+	for name := range columns {
+		if !contains(importColumns, name) && !contains(optionalImportColumns, name) {
+			return fmt.Errorf("unknown CSV column %q, expected %s", name, strings.Join(append(importColumns, optionalImportColumns...), ", "))
+		}
+	}
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("CSV column %q is missing", name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+			err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+			if err := row(parseErr.StartLine, models.Product{}, err); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		p := models.Product{Name: record[columns["name"]]}
+		p.Price.Currency = strings.TrimSpace(record[columns["currency"]])
+		p.Price.Amount, err = money.ParseAmount(strings.TrimSpace(record[columns["price"]]))
+		if i, ok := columns["sku"]; ok {
+			p.SKU = strings.TrimSpace(record[i])
+		}
+		if err := row(line, p, err); err != nil {
+			return err
+		}
+	}
+}
+
+// readNDJSON reads a product from each line of newline delimited JSON. Blank
+// lines are skipped.
+func readNDJSON(body io.Reader, row importRow) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), maxImportLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var p models.Product
+		err := codec.JSON{}.Decode(bytes.NewReader(text), &p)
+		var decodeErr *codec.DecodeError
+		if errors.As(err, &decodeErr) && !errors.Is(err, money.ErrInvalid) {
+			// a line is a document of its own, so only the column adds to the
+			// line number of the report
+			where := ""
+			if decodeErr.Column > 0 {
+				where = fmt.Sprintf(" at column %d", decodeErr.Column)
+			}
+			decodeErr.Line = 0
+			err = fmt.Errorf("invalid JSON%s: %v", where, decodeErr)
+		}
+		if err := row(line, p, err); err != nil {
+			return err
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return fmt.Errorf("NDJSON lines are limited to %d bytes", maxImportLine)
+	}
+	return scanner.Err()
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IMPORT
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := checkParameters(query, importParameters); err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	dryRun, err := parseDryRun(query)
+	if err != nil {
+		Problem(w, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+
+	var read func(io.Reader, importRow) error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		read = readCSV
+	case "application/x-ndjson", "application/ndjson":
+		read = readNDJSON
+	default:
+		Problem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "An import must be text/csv or application/x-ndjson")
+		return
+	}
+
+	r, cancel := extendTimeout(w, r, h.ImportTimeout)
+	defer cancel()
+	ctx := r.Context()
+
+	report := models.ImportReport{DryRun: dryRun, Errors: []models.ImportError{}}
+	var products []models.Product
+	var lines []int
+	err = read(http.MaxBytesReader(w, r.Body, maxImportSize), func(line int, p models.Product, err error) error {
+		if err == nil {
+			err = validateProduct(p)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, models.ImportError{Line: line, Error: err.Error()})
+			return nil
+		}
+		if len(products) == MaxImportRows {
+			return errTooManyRows
+		}
+		products = append(products, p)
+		lines = append(lines, line)
+		return nil
+	})
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		Problem(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("An import is limited to %d bytes", maxImportSize))
+		return
+	case errors.Is(err, errTooManyRows):
+		Problem(w, http.StatusRequestEntityTooLarge, CodeTooManyItems, err.Error())
+		return
+	case err != nil:
+		Problem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+		return
+	}
+
+	if len(products) > 0 {
+		results, err := h.Repo.ImportProducts(ctx, products, dryRun)
+		if err != nil {
+			RepositoryError(w, err, "could not import products")
+			return
+		}
+
+		// the first line of each SKU, of each name without a SKU, and of each
+		// product written
+		firstSKU, firstName := make(map[string]int), make(map[string]int)
+		firstID := make(map[int64]int)
+		for j, res := range results {
+			p := products[j]
+			if _, ok := firstSKU[p.SKU]; p.SKU != "" && !ok {
+				firstSKU[p.SKU] = lines[j]
+			}
+			if _, ok := firstName[p.Name]; p.SKU == "" && !ok {
+				firstName[p.Name] = lines[j]
+			}
+			if _, ok := firstID[res.ID]; res.Err == nil && res.ID != 0 && !ok {
+				firstID[res.ID] = lines[j]
+			}
+
+			var msg string
+			switch {
+			case errors.Is(res.Err, repository.ErrDuplicateImport) && res.ID != 0:
+				msg = fmt.Sprintf("Product %d was already imported on line %d", res.ID, firstID[res.ID])
+			case errors.Is(res.Err, repository.ErrDuplicateImport) && p.SKU != "":
+				msg = fmt.Sprintf("SKU %q was already imported on line %d", p.SKU, firstSKU[p.SKU])
+			case errors.Is(res.Err, repository.ErrDuplicateImport):
+				msg = fmt.Sprintf("Name %q was already imported on line %d", p.Name, firstName[p.Name])
+			case errors.Is(res.Err, repository.ErrAmbiguousName):
+				msg = fmt.Sprintf("Several products are named %q", p.Name)
+			case res.Err != nil:
+				_, _, msg = repositoryProblem(res.Err, "could not import product")
+			case res.Action == repository.ImportCreated:
+				report.Created++
+			case res.Action == repository.ImportUpdated:
+				report.Updated++
+			case res.Action == repository.ImportUnchanged:
+				report.Unchanged++
+			}
+			if msg != "" {
+				report.Errors = append(report.Errors, models.ImportError{Line: lines[j], Error: msg})
+			}
+		}
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	report.Failed = len(report.Errors)
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	respond(w, status, report)
+}
@@ -0,0 +1,265 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func importRequest(query, contentType, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/products/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func decodeImportReport(t *testing.T, body string) models.ImportReport {
+	t.Helper()
+
+	var report models.ImportReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	return report
+}
+
+func TestImportProducts_CSV(t *testing.T) {
+	var received []models.Product
+	var receivedDryRun bool
+	mockRepo := &repository.MockManualProductRepository{
+		ImportProductsFunc: func(ctx context.Context, products []models.Product, dryRun bool) ([]repository.ImportResult, error) {
+			received, receivedDryRun = products, dryRun
+			return []repository.ImportResult{
+				{Action: repository.ImportCreated, ID: 1},
+				{Action: repository.ImportUpdated, ID: 2},
+				{Err: fmt.Errorf("%q: %w", "Tea", repository.ErrDuplicateImport)},
+			}, nil
+		},
+	}
+
+	body := "\ufeffCurrency,Name,Price\nEUR,Tea,2.50\nEUR,\"Coffee, ground\",3\nUSD,,1\nEUR,Milk,1.005\nEUR,Tea,2\nEUR,Short\n"
+	rr := serve(mockRepo, importRequest("", "text/csv; charset=utf-8", body))
+
+	if status := rr.Code; status != http.StatusMultiStatus {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusMultiStatus, status, rr.Body.String())
+	}
+	if len(received) != 3 || received[1].Name != "Coffee, ground" || received[0].Price != money.MustParse("2.5", "EUR") || receivedDryRun {
+		t.Errorf("unexpected products %v (dry run %v)", received, receivedDryRun)
+	}
+
+	report := decodeImportReport(t, rr.Body.String())
+	if report.Created != 1 || report.Updated != 1 || report.Unchanged != 0 || report.Failed != 4 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	var lines []int
+	for _, e := range report.Errors {
+		lines = append(lines, e.Line)
+	}
+	if got := fmt.Sprint(lines); got != "[4 5 6 7]" {
+		t.Fatalf("expected errors on lines [4 5 6 7], got %s: %+v", got, report.Errors)
+	}
+	if report.Errors[0].Error != "Name is required" {
+		t.Errorf("expected the validation error, got %q", report.Errors[0].Error)
+	}
+	if report.Errors[2].Error != `Name "Tea" was already imported on line 2` {
+		t.Errorf("expected the duplicate to point to its first line, got %q", report.Errors[2].Error)
+	}
+}
+
+func TestImportProducts_NDJSONDryRun(t *testing.T) {
+	var receivedDryRun bool
+	mockRepo := &repository.MockManualProductRepository{
+		ImportProductsFunc: func(ctx context.Context, products []models.Product, dryRun bool) ([]repository.ImportResult, error) {
+			receivedDryRun = dryRun
+			return []repository.ImportResult{{Action: repository.ImportUnchanged, ID: 1}, {Action: repository.ImportCreated}}, nil
+		},
+	}
+
+	body := `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}
+
+{"name":"Coffee","price":{"amount":"3","currency":"EUR"}}
+`
+	rr := serve(mockRepo, importRequest("?dry_run=true", "application/x-ndjson", body))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	report := decodeImportReport(t, rr.Body.String())
+	if !receivedDryRun || !report.DryRun || report.Created != 1 || report.Unchanged != 1 || report.Failed != 0 || report.Errors == nil {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestImportProducts_NDJSONInvalidLines(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ImportProductsFunc: func(ctx context.Context, products []models.Product, dryRun bool) ([]repository.ImportResult, error) {
+			return []repository.ImportResult{{Action: repository.ImportCreated, ID: 1}}, nil
+		},
+	}
+
+	body := "{\"name\":\"Tea\",\"price\":{\"amount\":\"2.50\",\"currency\":\"EUR\"}}\n{\"name\":\n{\"name\":\"Coffee\",\"price\":{\"amount\":\"3\",\"currency\":\"XYZ\"}}\n" +
+		"{\"name\":\"Milk\",\"colour\":\"white\"}\n{\"sku\":\"-tea\",\"name\":\"Tea\",\"price\":{\"amount\":\"2\",\"currency\":\"EUR\"}}\n"
+	rr := serve(mockRepo, importRequest("", "application/ndjson", body))
+
+	report := decodeImportReport(t, rr.Body.String())
+	if rr.Code != http.StatusMultiStatus || report.Created != 1 || len(report.Errors) != 4 ||
+		report.Errors[0].Line != 2 || report.Errors[1].Line != 3 || report.Errors[2].Line != 4 || report.Errors[3].Line != 5 {
+		t.Fatalf("unexpected report %d %+v", rr.Code, report)
+	}
+	if expected := "invalid JSON at column 9: unexpected end of JSON input"; report.Errors[0].Error != expected {
+		t.Errorf("expected %q, got %q", expected, report.Errors[0].Error)
+	}
+	if expected := `invalid JSON at column 16: unknown field "colour"`; report.Errors[2].Error != expected {
+		t.Errorf("expected %q, got %q", expected, report.Errors[2].Error)
+	}
+	if expected := "SKU is not in the expected format"; report.Errors[3].Error != expected {
+		t.Errorf("expected %q, got %q", expected, report.Errors[3].Error)
+	}
+}
+
+func TestImportProducts_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	body := "name,price,currency\nTea,2.50,EUR\nCoffee,3,EUR\n"
+
+	rr := serve(repo, importRequest("", "text/csv", body))
+	if report := decodeImportReport(t, rr.Body.String()); rr.Code != http.StatusOK || report.Created != 2 {
+		t.Fatalf("unexpected first import %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// importing again updates by name instead of creating
+	body = "name,price,currency\nTea,2.50,EUR\nCoffee,4,EUR\n"
+	rr = serve(repo, importRequest("", "text/csv", body))
+	if report := decodeImportReport(t, rr.Body.String()); report.Unchanged != 1 || report.Updated != 1 || report.Created != 0 {
+		t.Errorf("unexpected second import %+v", report)
+	}
+
+	page, _ := repo.ListProducts(context.Background(), repository.ListOptions{})
+	if len(page.Products) != 2 || page.Products[1].Price != money.MustParse("4", "EUR") {
+		t.Errorf("expected 2 products with Coffee at 4 EUR, got %+v", page.Products)
+	}
+}
+
+func TestImportProducts_SKU(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	if rr := serve(repo, putSKU("TEA-1", `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`)); rr.Code != http.StatusCreated {
+		t.Fatalf("unexpected upsert %d %s", rr.Code, rr.Body.String())
+	}
+
+	// the SKU is the natural key of both the import and PUT /products/sku/{sku}
+	body := "sku,name,price,currency\nTEA-1,Green tea,3,EUR\nCOF-1,Coffee,4,EUR\nTEA-1,Black tea,5,EUR\n,Milk,1,EUR\n"
+	rr := serve(repo, importRequest("", "text/csv", body))
+	report := decodeImportReport(t, rr.Body.String())
+	if rr.Code != http.StatusMultiStatus || report.Updated != 1 || report.Created != 2 || len(report.Errors) != 1 {
+		t.Fatalf("unexpected import %d %+v", rr.Code, report)
+	}
+	if expected := `SKU "TEA-1" was already imported on line 2`; report.Errors[0].Line != 4 || report.Errors[0].Error != expected {
+		t.Errorf("expected %q on line 4, got %+v", expected, report.Errors[0])
+	}
+
+	req, _ := http.NewRequest("GET", "/products/sku/TEA-1", nil)
+	var tea models.Product
+	if rr := serve(repo, req); rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&tea) != nil ||
+		tea.ID != 1 || tea.Name != "Green tea" || tea.Price != money.MustParse("3", "EUR") || tea.Version != 2 {
+		t.Errorf("expected the import to replace the product with the SKU, got %+v", tea)
+	}
+	req, _ = http.NewRequest("GET", "/products/sku/COF-1", nil)
+	if rr := serve(repo, req); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"Coffee"`) {
+		t.Errorf("expected the import to create the product with the SKU, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// PUT by SKU then finds what the import created
+	if rr := serve(repo, putSKU("COF-1", `{"name":"Coffee","price":{"amount":"6","currency":"EUR"}}`)); rr.Code != http.StatusOK {
+		t.Errorf("expected PUT to replace the imported product, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestImportProducts_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"UnsupportedMediaType", "", "application/json", `[]`, http.StatusUnsupportedMediaType},
+		{"UnknownParameter", "?mode=partial", "text/csv", "name,price,currency\n", http.StatusBadRequest},
+		{"InvalidDryRun", "?dry_run=maybe", "text/csv", "name,price,currency\n", http.StatusBadRequest},
+		{"NoHeader", "", "text/csv", "", http.StatusBadRequest},
+		{"MissingColumn", "", "text/csv", "name,price\nTea,2\n", http.StatusBadRequest},
+		{"UnknownColumn", "", "text/csv", "name,price,currency,color\nTea,2,EUR,green\n", http.StatusBadRequest},
+		{"InvalidSKUColumn", "", "text/csv", "name,price,currency,sku\nTea,2,EUR,-tea\n", http.StatusMultiStatus},
+		{"RepeatedColumn", "", "text/csv", "name,price,currency,name\n", http.StatusBadRequest},
+		{"MalformedCSV", "", "text/csv", "name,price,currency\n\"Tea,2,EUR\n", http.StatusBadRequest},
+		{"LongLine", "", "application/x-ndjson", strings.Repeat(" ", 2<<20), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockManualProductRepository{
+				ImportProductsFunc: func(ctx context.Context, products []models.Product, dryRun bool) ([]repository.ImportResult, error) {
+					t.Fatalf("expected no import, got %v", products)
+					return nil, nil
+				},
+			}
+
+			rr := serve(mockRepo, importRequest(tt.query, tt.contentType, tt.body))
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestImportProducts_TooManyRows(t *testing.T) {
+	var body strings.Builder
+	body.WriteString("name,price,currency\n")
+	for i := 0; i <= handlers.MaxImportRows; i++ {
+		fmt.Fprintf(&body, "Product %d,1,EUR\n", i)
+	}
+
+	rr := serve(&repository.MockManualProductRepository{}, importRequest("", "text/csv", body.String()))
+	if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
+
+func TestImportProducts_OutlastsServerTimeouts(t *testing.T) {
+	var deadline time.Time
+	mockRepo := &repository.MockManualProductRepository{
+		ImportProductsFunc: func(ctx context.Context, products []models.Product, dryRun bool) ([]repository.ImportResult, error) {
+			deadline, _ = ctx.Deadline()
+			// longer than the write timeout of the server
+			time.Sleep(300 * time.Millisecond)
+			return []repository.ImportResult{{Action: repository.ImportCreated, ID: 1}}, nil
+		},
+	}
+	router := mux.NewRouter()
+	(&handlers.ProductHandler{Repo: mockRepo, ImportTimeout: time.Minute}).RegisterRoutes(router)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/products/import", "text/csv", strings.NewReader("name,price,currency\nTea,2.50,EUR\n"))
+	if err != nil {
+		t.Fatalf("expected the import to outlast the write timeout, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if remaining := time.Until(deadline); remaining < 30*time.Second || remaining > time.Minute {
+		t.Errorf("expected the import to be bounded by its own timeout, got a deadline in %v", remaining)
+	}
+}
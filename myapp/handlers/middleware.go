@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+)
+
+// Actors recorded for requests with the admin token, and for requests that
+// do not come from the authenticating proxy.
+const (
+	AdminActor     = "admin"
+	AnonymousActor = "anonymous"
+)
+
+// ProxyTokenHeader carries the token of the authenticating proxy, without
+// which X-Actor is not trusted.
+const ProxyTokenHeader = "X-Proxy-Token"
+
+// maxHeaderIDLength bounds the request IDs and actors accepted from headers.
+const maxHeaderIDLength = 128
+
+// requestContext tells the repository who makes the request, for the audit
+// log. The request ID comes from X-Request-ID when a valid one was sent, and
+// is echoed in the response either way. The actor is taken from X-Actor only
+// when the request carries the proxy token; any other X-Actor could be forged
+// by the client, so the request is anonymous and X-Actor is only recorded as
+// the claimed actor.
+func (h *ProductHandler) requestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validHeaderID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		info := audit.Info{Actor: AnonymousActor, RequestID: requestID}
+		actor := r.Header.Get("X-Actor")
+		switch {
+		case h.isAdmin(r):
+			info.Actor = AdminActor
+		case h.isProxy(r) && validHeaderID(actor):
+			info.Actor = actor
+		case validHeaderID(actor):
+			info.ClaimedActor = actor
+		}
+
+		next.ServeHTTP(w, r.WithContext(audit.WithInfo(r.Context(), info)))
+	})
+}
+
+// validHeaderID accepts short printable ASCII values, which are safe to store
+// and to log.
+func validHeaderID(id string) bool {
+	if id == "" || len(id) > maxHeaderIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
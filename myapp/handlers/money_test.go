@@ -0,0 +1,105 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func TestCreateProduct_Money(t *testing.T) {
+	var received models.Product
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			received = p
+			return 1, nil
+		},
+	}
+
+	body := `{"name":"Tea","price":{"amount":"1500","currency":"JPY"}}`
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(body))
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	if expected := money.MustParse("1500", "JPY"); received.Price != expected {
+		t.Errorf("expected price %v, got %v", expected, received.Price)
+	}
+}
+
+func TestCreateProduct_InvalidMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    string
+		expected string
+	}{
+		{"Missing", `null`, "Price is required"},
+		{"UnknownCurrency", `{"amount":"10","currency":"XYZ"}`, "currency must be an ISO 4217 code"},
+		{"LowerCaseCurrency", `{"amount":"10","currency":"usd"}`, "currency must be an ISO 4217 code"},
+		{"CentsInYen", `{"amount":"19.50","currency":"JPY"}`, "JPY amounts have at most 0 decimal places"},
+		{"TooManyDecimals", `{"amount":"19.999","currency":"EUR"}`, "EUR amounts have at most 2 decimal places"},
+		{"Negative", `{"amount":"-1","currency":"EUR"}`, "Price must be greater than 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &repository.MockManualProductRepository{
+				InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+					t.Fatalf("expected no insert, got %+v", p)
+					return 0, nil
+				},
+			}
+
+			body := `{"name":"Tea","price":` + tt.price + `}`
+			req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(body))
+			rr := serve(mockRepo, req)
+
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expected) {
+				t.Errorf("expected error %q, got %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateProductByID_InvalidMoney(t *testing.T) {
+	for _, price := range []string{`19.99`, `{"amount":"1e3","currency":"EUR"}`, `{"amount":"10.5","currency":"KRW"}`} {
+		mockRepo := &repository.MockManualProductRepository{
+			UpdateProductByIDFunc: func(ctx context.Context, id int64, p models.Product) error {
+				t.Fatalf("expected no update, got %+v", p)
+				return nil
+			},
+		}
+
+		body := `{"name":"Tea","price":` + price + `}`
+		req, _ := http.NewRequest("PUT", "/products/1", bytes.NewBufferString(body))
+		rr := serve(mockRepo, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", price, http.StatusBadRequest, status, rr.Body.String())
+		}
+	}
+}
+
+func TestGetProductByID_MoneyAsString(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{ID: id, Name: "Tea", Price: money.MustParse("0.3", "KWD"), Version: 1}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1", nil)
+	rr := serve(mockRepo, req)
+
+	if expected := `"price":{"amount":"0.300","currency":"KWD"}`; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("expected %s in %s", expected, rr.Body.String())
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+)
+
+// DefaultCodecs returns the codecs used when ProductHandler.Codecs is nil:
+// JSON, which is the default, XML, MessagePack, and CSV for products.
+func DefaultCodecs() *codec.Registry {
+	return codec.NewRegistry(codec.JSON{}, codec.XML{}, codec.MessagePack{}, productCSV{})
+}
+
+var defaultCodecs = DefaultCodecs()
+
+func (h *ProductHandler) codecs() *codec.Registry {
+	if h.Codecs != nil {
+		return h.Codecs
+	}
+	return defaultCodecs
+}
+
+// errNotAcceptable means the client accepts none of the registered media
+// types.
+var errNotAcceptable = errors.New("no acceptable media type")
+
+// negotiatedWriter carries the codec chosen for a response, so that every
+// helper writing to it answers in that media type, problems included.
+type negotiatedWriter struct {
+	http.ResponseWriter
+	registry *codec.Registry
+	// codec is nil when the client accepts none of the registry.
+	codec codec.Codec
+	// instance is the path of the request, for problem details.
+	instance string
+}
+
+// Unwrap lets http.NewResponseController reach the connection.
+func (nw *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// negotiate picks the codec of the response from the Accept header.
+func (h *ProductHandler) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		registry := h.codecs()
+		next.ServeHTTP(&negotiatedWriter{w, registry, registry.Negotiate(r.Header.Get("Accept")), r.URL.Path}, r)
+	})
+}
+
+// registryFor returns the registry of a negotiated response, or the default
+// one for a handler called without the negotiate middleware.
+func registryFor(w http.ResponseWriter) *codec.Registry {
+	if nw, ok := w.(*negotiatedWriter); ok {
+		return nw.registry
+	}
+	return defaultCodecs
+}
+
+// encode returns v in the negotiated media type, which is JSON for a handler
+// called without the negotiate middleware.
+func encode(w http.ResponseWriter, v interface{}) (body []byte, mediaType string, err error) {
+	var c codec.Codec = codec.JSON{}
+	if nw, ok := w.(*negotiatedWriter); ok {
+		if nw.codec == nil {
+			return nil, "", errNotAcceptable
+		}
+		c = nw.codec
+	}
+
+	body, err = encodeWith(c, v)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, c.MediaType(), nil
+}
+
+func encodeWith(c codec.Codec, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// respond writes v with status in the negotiated media type, or answers 406
+// when no acceptable media type can represent v.
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	body, mediaType, err := encode(w, v)
+	if errors.Is(err, errNotAcceptable) || errors.Is(err, codec.ErrUnsupported) {
+		notAcceptable(w)
+		return
+	} else if err != nil {
+		Problem(w, http.StatusInternalServerError, CodeInternalError, "could not encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func notAcceptable(w http.ResponseWriter) {
+	types := strings.Join(registryFor(w).MediaTypes(), ", ")
+	Problem(w, http.StatusNotAcceptable, CodeNotAcceptable, "Accept must allow one of "+types)
+}
+
+// requestDecoder returns the codec reading the request body, chosen by its
+// Content-Type, which is JSON when the request has none. It answers 415 and
+// returns nil when no codec reads the Content-Type.
+func requestDecoder(w http.ResponseWriter, r *http.Request) codec.Decoder {
+	registry := registryFor(w)
+	d := registry.Decoder(r.Header.Get("Content-Type"))
+	if d == nil {
+		types := strings.Join(registry.DecodedMediaTypes(), ", ")
+		Problem(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be one of "+types)
+	}
+	return d
+}
+
+// maxBodySize caps the size of a request body holding one product.
+const maxBodySize = 1 << 20
+
+// decodeBody reads the request body into v with the codec of its
+// Content-Type. The body must hold a single document of at most limit bytes,
+// without fields v does not have. decodeBody answers the request and returns
+// false when the body cannot be read.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) bool {
+	dec := requestDecoder(w, r)
+	if dec == nil {
+		return false
+	}
+
+	err := dec.Decode(http.MaxBytesReader(w, r.Body, limit), v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &tooLarge):
+		Problem(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("The request body is limited to %d bytes", limit))
+	case errors.Is(err, money.ErrInvalid):
+		Problem(w, http.StatusBadRequest, CodeValidationFailed, err.Error())
+	default:
+		Problem(w, http.StatusBadRequest, CodeMalformedBody, "Malformed request body: "+err.Error())
+	}
+	return false
+}
+
+// productCSV writes products, alone or in a list, as CSV with the columns of
+// the export.
+type productCSV struct{}
+
+func (productCSV) MediaType() string { return "text/csv" }
+
+func (productCSV) Encode(w io.Writer, v interface{}) error {
+	var products []models.Product
+	switch v := v.(type) {
+	case models.Product:
+		products = []models.Product{v}
+	case []models.Product:
+		products = v
+	default:
+		return codec.ErrUnsupported
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	for _, p := range products {
+		cw.Write(exportRecord(p))
+	}
+	cw.Flush()
+	return cw.Error()
+}
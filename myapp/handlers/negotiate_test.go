@@ -0,0 +1,156 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/codec"
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func TestGetProductByID_Accept(t *testing.T) {
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"", http.StatusOK, "application/json", `"name":"Test Product"`},
+		{"application/xml", http.StatusOK, "application/xml", `<name>Test Product</name>`},
+		{"text/csv", http.StatusOK, "text/csv", "1,Test Product,10.00,USD,3,"},
+		{"application/msgpack", http.StatusOK, "application/msgpack", "Test Product"},
+		{"text/html", http.StatusNotAcceptable, "application/problem+json", `"code":"not_acceptable"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products/1", nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := serve(versionedMock(new(models.Product)), req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, ct)
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("expected the body to contain %s, got %s", tt.contains, rr.Body.String())
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("expected Vary: Accept, got %q", rr.Header().Get("Vary"))
+			}
+			// the ETag does not depend on the media type
+			if tt.status == http.StatusOK && rr.Header().Get("ETag") != handlers.ETag(versioned) {
+				t.Errorf("expected ETag %q, got %q", handlers.ETag(versioned), rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestAccept_NotRepresentable(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductPricesFunc: func(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+			return []models.PricePeriod{}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1/prices", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusNotAcceptable {
+		t.Errorf("expected status code %d, got %d", http.StatusNotAcceptable, status)
+	}
+}
+
+func TestAccept_Errors(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/abc", nil)
+	req.Header.Set("Accept", "application/xml")
+	rr := serve(&repository.MockManualProductRepository{}, req)
+
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/problem+xml" {
+		t.Fatalf("expected a 400 in XML, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), "<code>invalid_product_id</code>") {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+}
+
+func TestCreateProduct_ContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/json", `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`, http.StatusOK},
+		{"application/xml", `<product><name>Tea</name><price><amount>2.50</amount><currency>EUR</currency></price></product>`, http.StatusOK},
+		{"text/csv", "name,price,currency\nTea,2.50,EUR\n", http.StatusUnsupportedMediaType},
+		{"text/plain", "Tea", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			var received models.Product
+			mockRepo := &repository.MockManualProductRepository{
+				InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+					received = p
+					return 1, nil
+				},
+			}
+
+			req, _ := http.NewRequest("POST", "/products", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := serve(mockRepo, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status == http.StatusOK && (received.Name != "Tea" || received.Price.String() != "2.50 EUR") {
+				t.Errorf("unexpected product %+v", received)
+			}
+		})
+	}
+}
+
+func TestBulkCreate_MessagePack(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductsFunc: func(ctx context.Context, products []models.Product, atomic bool) ([]repository.BatchResult, error) {
+			return []repository.BatchResult{{ID: 1}}, nil
+		},
+	}
+
+	var body bytes.Buffer
+	(codec.MessagePack{}).Encode(&body, []models.Product{{Name: "Tea", Price: usd("2")}})
+	req, _ := http.NewRequest("POST", "/products/bulk", &body)
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Accept", "application/msgpack")
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	var report models.BulkReport
+	if err := (codec.MessagePack{}).Decode(rr.Body, &report); err != nil || report.Succeeded != 1 {
+		t.Errorf("unexpected report %+v (%v)", report, err)
+	}
+}
+
+func TestCustomCodecs(t *testing.T) {
+	handler := handlers.ProductHandler{Repo: versionedMock(new(models.Product)), Codecs: codec.NewRegistry(codec.XML{})}
+	req, _ := http.NewRequest("GET", "/products/1", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := serveHandler(&handler, req)
+
+	if status := rr.Code; status != http.StatusNotAcceptable {
+		t.Errorf("expected status code %d, got %d", http.StatusNotAcceptable, status)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected the error in JSON, got %q", ct)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// EncodeCursor turns a repository cursor into the opaque value clients send
+// back in the after query parameter.
+func EncodeCursor(c repository.Cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string) (repository.Cursor, error) {
+	var c repository.Cursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// parseLimit reads the limit parameter, between 1 and MaxPageSize.
+func parseLimit(query url.Values, fallback int) (int, error) {
+	v := query.Get("limit")
+	if v == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+	return limit, nil
+}
+
+// parseListOptions reads the page, filter and sort from the query string.
+func parseListOptions(query url.Values) (repository.ListOptions, error) {
+	opts := repository.ListOptions{Limit: DefaultPageSize}
+
+	if err := checkParameters(query, listParameters); err != nil {
+		return opts, err
+	}
+
+	var err error
+	if opts.Limit, err = parseLimit(query, DefaultPageSize); err != nil {
+		return opts, err
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return opts, errors.New("offset must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+
+	if v := query.Get("after"); v != "" {
+		if opts.Offset > 0 {
+			return opts, errors.New("offset and after cannot be used together")
+		}
+		cursor, err := DecodeCursor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.After = &cursor
+	}
+
+	if opts.Filter, err = parseProductFilter(query); err != nil {
+		return opts, err
+	}
+	if opts.Sort, err = parseSort(query); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// setPageHeaders describes the page in X-Total-Count and, when more products
+// follow, in X-Next-Cursor and a Link header pointing to the next page.
+func setPageHeaders(w http.ResponseWriter, r *http.Request, page repository.ProductPage) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.Next != nil {
+		setNextPage(w, r, EncodeCursor(*page.Next))
+	}
+}
+
+// parseHistoryOptions reads the page of a product history from the query
+// string. after is the ID of the last entry of the previous page.
+func parseHistoryOptions(query url.Values) (repository.HistoryOptions, error) {
+	var opts repository.HistoryOptions
+
+	if err := checkParameters(query, historyParameters); err != nil {
+		return opts, err
+	}
+
+	var err error
+	if opts.Limit, err = parseLimit(query, DefaultPageSize); err != nil {
+		return opts, err
+	}
+
+	if v := query.Get("after"); v != "" {
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 1 {
+			return opts, errors.New("invalid cursor")
+		}
+		opts.After = after
+	}
+
+	return opts, nil
+}
+
+// setNextPage points to the page starting after cursor, in X-Next-Cursor and
+// in a Link header.
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	w.Header().Set("X-Next-Cursor", cursor)
+
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Set("after", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
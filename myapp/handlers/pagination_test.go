@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func TestGetAll_PageOptions(t *testing.T) {
+	var received repository.ListOptions
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			received = opts
+			return repository.ProductPage{Products: []models.Product{}}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	cursor := handlers.EncodeCursor(repository.Cursor{ID: 42})
+	req, _ := http.NewRequest("GET", "/products/list?limit=10&after="+cursor, nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if received.Limit != 10 || received.Offset != 0 || received.After == nil || received.After.ID != 42 {
+		t.Errorf("unexpected list options %+v", received)
+	}
+}
+
+func TestGetAll_DefaultPageSize(t *testing.T) {
+	var received repository.ListOptions
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			received = opts
+			return repository.ProductPage{Products: []models.Product{}}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	req, _ := http.NewRequest("GET", "/products/list?offset=20", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	if received.Limit != handlers.DefaultPageSize || received.Offset != 20 || received.After != nil {
+		t.Errorf("unexpected list options %+v", received)
+	}
+}
+
+func TestGetAll_InvalidPageOptions(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{}
+	handler := handlers.ProductHandler{Repo: mockRepo}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+
+	for _, query := range []string{
+		"limit=0",
+		fmt.Sprintf("limit=%d", handlers.MaxPageSize+1),
+		"limit=ten",
+		"offset=-1",
+		"after=not-a-cursor",
+		"offset=5&after=" + handlers.EncodeCursor(repository.Cursor{ID: 1}),
+	} {
+		req, _ := http.NewRequest("GET", "/products/list?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestGetAll_PageHeaders(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductsFunc: func(ctx context.Context, opts repository.ListOptions) (repository.ProductPage, error) {
+			return repository.ProductPage{
+				Products: []models.Product{{ID: 1, Name: "Product 1", Price: usd("10")}},
+				Total:    3,
+				Next:     &repository.Cursor{ID: 1},
+			}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	req, _ := http.NewRequest("GET", "/products/list?limit=1", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+	router.ServeHTTP(rr, req)
+
+	cursor := handlers.EncodeCursor(repository.Cursor{ID: 1})
+	if got := rr.Header().Get("X-Total-Count"); got != "3" {
+		t.Errorf("expected X-Total-Count 3, got %q", got)
+	}
+	if got := rr.Header().Get("X-Next-Cursor"); got != cursor {
+		t.Errorf("expected X-Next-Cursor %q, got %q", cursor, got)
+	}
+	expectedLink := fmt.Sprintf(`</products/list?after=%s&limit=1>; rel="next"`, cursor)
+	if got := rr.Header().Get("Link"); got != expectedLink {
+		t.Errorf("expected Link %s, got %s", expectedLink, got)
+	}
+}
+
+func TestGetAll_WalkPagesWithMemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	for i := 0; i < 5; i++ {
+		repo.InsertProduct(context.Background(), models.Product{Name: fmt.Sprintf("Product %d", i), Price: usd("1")})
+	}
+
+	handler := handlers.ProductHandler{Repo: repo}
+	router := mux.NewRouter()
+	router.HandleFunc("/products/list", handler.GetAllProducts).Methods("GET")
+
+	pages := 0
+	url := "/products/list?limit=2"
+	for url != "" {
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		pages++
+
+		url = ""
+		if next := rr.Header().Get("X-Next-Cursor"); next != "" {
+			url = "/products/list?limit=2&after=" + next
+		}
+	}
+
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/jsonpatch"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func patchRequest(t *testing.T, repo repository.ProductRepository, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	handler := handlers.ProductHandler{Repo: repo}
+	req, _ := http.NewRequest("PATCH", "/products/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func patchMock(received *repository.ProductChanges) *repository.MockManualProductRepository {
+	current := models.Product{ID: 1, Name: "Orange Juice", Price: usd("3"), Version: 1}
+	return &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return current, nil
+		},
+		PatchProductByIDFunc: func(ctx context.Context, id int64, changes repository.ProductChanges) (models.Product, error) {
+			*received = changes
+			p := current
+			if changes.Name != nil {
+				p.Name = *changes.Name
+			}
+			if changes.Price != nil {
+				p.Price = *changes.Price
+			}
+			p.Version++
+			return p, nil
+		},
+	}
+}
+
+func TestPatchProduct_MergePatch(t *testing.T) {
+	var received repository.ProductChanges
+	rr := patchRequest(t, patchMock(&received), jsonpatch.MergePatchType, `{"price": {"amount": "4.50"}}`)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	if received.Name != nil || received.Price == nil || *received.Price != usd("4.5") {
+		t.Errorf("expected only the price to change, got %+v", received)
+	}
+	if received.Version != 1 {
+		t.Errorf("expected the patch to require version 1, got %d", received.Version)
+	}
+
+	expected := models.Product{ID: 1, Name: "Orange Juice", Price: usd("4.5"), Version: 2}
+	if etag := rr.Header().Get("ETag"); etag != handlers.ETag(expected) {
+		t.Errorf("expected ETag %q, got %q", handlers.ETag(expected), etag)
+	}
+	var actual models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&actual); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if actual != expected {
+		t.Errorf("expected product %v, got %v", expected, actual)
+	}
+}
+
+func TestPatchProduct_JSONPatch(t *testing.T) {
+	var received repository.ProductChanges
+	body := `[{"op": "test", "path": "/name", "value": "Orange Juice"}, {"op": "replace", "path": "/name", "value": "Apple Juice"}]`
+	rr := patchRequest(t, patchMock(&received), jsonpatch.JSONPatchType, body)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, status, rr.Body.String())
+	}
+	if received.Price != nil || received.Name == nil || *received.Name != "Apple Juice" {
+		t.Errorf("expected only the name to change, got %+v", received)
+	}
+}
+
+func TestPatchProduct_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"UnsupportedMediaType", "application/json", `{"price": {"amount": "4.50"}}`, http.StatusUnsupportedMediaType},
+		{"MalformedPatch", jsonpatch.MergePatchType, `{"price":`, http.StatusBadRequest},
+		{"UnknownOperation", jsonpatch.JSONPatchType, `[{"op": "increment", "path": "/price"}]`, http.StatusBadRequest},
+		{"TestFailed", jsonpatch.JSONPatchType, `[{"op": "test", "path": "/price", "value": 99}]`, http.StatusConflict},
+		{"MissingPath", jsonpatch.JSONPatchType, `[{"op": "remove", "path": "/color"}]`, http.StatusUnprocessableEntity},
+		{"UnknownField", jsonpatch.MergePatchType, `{"color": "orange"}`, http.StatusUnprocessableEntity},
+		{"ChangedID", jsonpatch.MergePatchType, `{"id": 2}`, http.StatusUnprocessableEntity},
+		{"ChangedVersion", jsonpatch.MergePatchType, `{"version": 7}`, http.StatusUnprocessableEntity},
+		{"RemovedName", jsonpatch.MergePatchType, `{"name": null}`, http.StatusBadRequest},
+		{"InvalidPrice", jsonpatch.JSONPatchType, `[{"op": "replace", "path": "/price/amount", "value": "-1"}]`, http.StatusBadRequest},
+		{"TooManyDecimals", jsonpatch.JSONPatchType, `[{"op": "replace", "path": "/price/amount", "value": "3.505"}]`, http.StatusBadRequest},
+		{"UnknownCurrency", jsonpatch.MergePatchType, `{"price": {"currency": "XYZ"}}`, http.StatusBadRequest},
+		{"NumericPrice", jsonpatch.MergePatchType, `{"price": 4.5}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received repository.ProductChanges
+			mockRepo := patchMock(&received)
+			mockRepo.PatchProductByIDFunc = func(ctx context.Context, id int64, changes repository.ProductChanges) (models.Product, error) {
+				t.Fatalf("expected no update, got %+v", changes)
+				return models.Product{}, nil
+			}
+
+			rr := patchRequest(t, mockRepo, tt.contentType, tt.body)
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status == http.StatusUnsupportedMediaType && rr.Header().Get("Accept-Patch") == "" {
+				t.Error("expected an Accept-Patch header")
+			}
+		})
+	}
+}
+
+func TestPatchProduct_NotFound(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{}, repository.ErrNotFound
+		},
+	}
+
+	rr := patchRequest(t, mockRepo, jsonpatch.MergePatchType, `{"price": {"amount": "4.50"}}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func TestGetProductPrices_Success(t *testing.T) {
+	changed := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductPricesFunc: func(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+			return []models.PricePeriod{
+				{Price: usd("10"), ValidFrom: changed.Add(-24 * time.Hour), ValidTo: &changed},
+				{Price: usd("12"), ValidFrom: changed},
+			}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1/prices", nil)
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	var prices []models.PricePeriod
+	if err := json.NewDecoder(rr.Body).Decode(&prices); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(prices) != 2 || prices[0].ValidTo == nil || prices[1].ValidTo != nil {
+		t.Errorf("unexpected prices %v", prices)
+	}
+}
+
+func TestGetProductPrices_NotFound(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		ListProductPricesFunc: func(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+			return nil, fmt.Errorf("no product found with ID %d: %w", id, repository.ErrNotFound)
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1/prices", nil)
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestGetProductByID_AsOf(t *testing.T) {
+	var received time.Time
+	mockRepo := &repository.MockManualProductRepository{
+		GetProductByIDFunc: func(ctx context.Context, id int64) (models.Product, error) {
+			return models.Product{ID: id, Name: "New name", Price: usd("10"), Version: 2}, nil
+		},
+		GetProductAsOfFunc: func(ctx context.Context, id int64, at time.Time) (models.Product, error) {
+			received = at
+			return models.Product{ID: id, Name: "Old name", Price: usd("10"), Version: 1}, nil
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/products/1?as_of="+url.QueryEscape("2024-05-01T12:30:00+02:00"), nil)
+	rr := serve(mockRepo, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if expected := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC); !received.Equal(expected) {
+		t.Errorf("expected as_of %v, got %v", expected, received)
+	}
+	var product models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if product.Name != "Old name" {
+		t.Errorf("unexpected product %v", product)
+	}
+}
+
+func TestGetProductByID_InvalidAsOf(t *testing.T) {
+	for _, query := range []string{"as_of=yesterday", "as_of=2024-05-01", "as_of=2024-05-01T10:00:00Z&include_deleted=true"} {
+		req, _ := http.NewRequest("GET", "/products/1?"+query, nil)
+		rr := serve(&repository.MockManualProductRepository{}, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestPriceTimeline_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	id, _ := repo.InsertProduct(context.Background(), models.Product{Name: "Product", Price: usd("10")})
+	before, _ := repo.GetProductByID(context.Background(), id)
+	time.Sleep(2 * time.Millisecond)
+	repo.UpdateProductByID(context.Background(), id, models.Product{Name: "Product", Price: usd("12")})
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/products/%d?as_of=%s", id, url.QueryEscape(before.UpdatedAt.Format(time.RFC3339Nano))), nil)
+	rr := serve(repo, req)
+
+	var product models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if product.Price != usd("10") {
+		t.Errorf("expected the price before the update, got %v", product)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/products/%d/prices", id), nil)
+	rr = serve(repo, req)
+
+	var prices []models.PricePeriod
+	if err := json.NewDecoder(rr.Body).Decode(&prices); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(prices) != 2 || prices[0].Price != usd("10") || prices[1].Price != usd("12") {
+		t.Errorf("unexpected prices %v", prices)
+	}
+}
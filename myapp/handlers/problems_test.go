@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func decodeProblem(t *testing.T, body *bytes.Buffer) models.Problem {
+	t.Helper()
+
+	var problem models.Problem
+	if err := json.NewDecoder(body).Decode(&problem); err != nil {
+		t.Fatalf("failed to decode problem %v", err)
+	}
+	return problem
+}
+
+func TestProblem_RouteNotFound(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/widgets", nil)
+	req.Header.Set("X-Request-ID", "req-404")
+	rr := serve(&repository.MockManualProductRepository{}, req)
+
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("expected a 404 problem, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	problem := decodeProblem(t, rr.Body)
+	if problem.Code != "route_not_found" || problem.Type != "/problems/route_not_found" || problem.Instance != "/widgets" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+	if id := rr.Header().Get("X-Request-ID"); id != "req-404" {
+		t.Errorf("expected the request ID to be echoed, got %q", id)
+	}
+}
+
+func TestProblem_MethodNotAllowed(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/products/1", nil)
+	rr := serve(&repository.MockManualProductRepository{}, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusMethodNotAllowed, rr.Code, rr.Body.String())
+	}
+	if allow := rr.Header().Get("Allow"); allow != "GET, PUT, PATCH, DELETE" {
+		t.Errorf("expected Allow %q, got %q", "GET, PUT, PATCH, DELETE", allow)
+	}
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Errorf("expected a request ID")
+	}
+	if problem := decodeProblem(t, rr.Body); problem.Code != "method_not_allowed" || problem.Status != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+func TestProblem_BulkFieldPointer(t *testing.T) {
+	body := `[{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}},{"name":"","price":{"amount":"3","currency":"EUR"}}]`
+	req, _ := http.NewRequest("POST", "/products/bulk", bytes.NewBufferString(body))
+	rr := serve(&repository.MockManualProductRepository{}, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	problem := decodeProblem(t, rr.Body)
+	if problem.Code != "validation_failed" || len(problem.Errors) != 1 || problem.Errors[0].Field != "/1/name" || problem.Errors[0].Code != "required" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+// A product is invalid with the same status and code whether the handler or
+// the database caught it.
+func TestProblem_ValidationFromEveryLayer(t *testing.T) {
+	mockRepo := &repository.MockManualProductRepository{
+		InsertProductFunc: func(ctx context.Context, p models.Product) (int64, error) {
+			return 0, fmt.Errorf("could not insert product: %w", repository.ErrValidation)
+		},
+	}
+
+	for _, body := range []string{
+		`{"name":"","price":{"amount":"1","currency":"USD"}}`,
+		`{"name":"Tea","price":{"amount":"1","currency":"USD"}}`,
+	} {
+		req, _ := http.NewRequest("POST", "/products", bytes.NewBufferString(body))
+		rr := serve(mockRepo, req)
+
+		if problem := decodeProblem(t, rr.Body); rr.Code != http.StatusBadRequest || problem.Code != handlers.CodeValidationFailed {
+			t.Errorf("%s: expected a 400 %s problem, got %d %+v", body, handlers.CodeValidationFailed, rr.Code, problem)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes adds the product endpoints to r. Fixed paths are registered
+// before /products/{id} so they are not taken for an ID.
+func (h *ProductHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/products", h.idempotent(h.CreateProduct)).Methods("POST")
+	r.HandleFunc("/products/list", h.GetAllProducts).Methods("GET")
+	r.HandleFunc("/products/search", h.SearchProducts).Methods("GET")
+	r.HandleFunc("/products/bulk", h.BulkCreateProducts).Methods("POST")
+	r.HandleFunc("/products/bulk", h.BulkUpdateProducts).Methods("PUT")
+	r.HandleFunc("/products/bulk", h.BulkDeleteProducts).Methods("DELETE")
+	r.HandleFunc("/products/export", h.ExportProducts).Methods("GET")
+	r.HandleFunc("/products/import", h.ImportProducts).Methods("POST")
+	r.HandleFunc("/products/sku/{sku}", h.GetProductBySKU).Methods("GET")
+	r.HandleFunc("/products/sku/{sku}", h.UpsertProductBySKU).Methods("PUT")
+	r.HandleFunc("/products/{id}", h.GetProductByID).Methods("GET")
+	r.HandleFunc("/products/{id}", h.DeleteProductByID).Methods("DELETE")
+	r.HandleFunc("/products/{id}", h.UpdateProductByID).Methods("PUT")
+	r.HandleFunc("/products/{id}", h.PatchProductByID).Methods("PATCH")
+	r.HandleFunc("/products/{id}/restore", h.RestoreProductByID).Methods("POST")
+	r.HandleFunc("/products/{id}/history", h.GetProductHistory).Methods("GET")
+	r.HandleFunc("/products/{id}/prices", h.GetProductPrices).Methods("GET")
+
+	r.Use(h.requestContext, h.negotiate)
+
+	// the router skips middleware for unmatched requests, so these handlers
+	// are wrapped themselves
+	r.NotFoundHandler = h.requestContext(h.negotiate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Problem(w, http.StatusNotFound, CodeRouteNotFound, "Route not found")
+	})))
+	r.MethodNotAllowedHandler = h.requestContext(h.negotiate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		allowed := allowedMethods(r, req)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		Problem(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, req.Method+" is not allowed, use "+strings.Join(allowed, " or "))
+	})))
+}
+
+// allowedMethods lists the methods router has a route for at the path of req.
+func allowedMethods(router *mux.Router, req *http.Request) []string {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
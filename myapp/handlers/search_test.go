@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/gorilla/mux"
+)
+
+func TestSearchProducts_Success(t *testing.T) {
+	var received repository.SearchQuery
+	mockRepo := &repository.MockManualProductRepository{
+		SearchProductsFunc: func(ctx context.Context, q repository.SearchQuery) ([]models.SearchResult, error) {
+			received = q
+			return []models.SearchResult{{
+				Product: models.Product{ID: 1, Name: "Orange Juice", Price: usd("3")},
+				Rank:    0.5,
+				Snippet: "<mark>Orange</mark> Juice",
+			}}, nil
+		},
+	}
+
+	handler := handlers.ProductHandler{Repo: mockRepo}
+	req, _ := http.NewRequest("GET", "/products/search?q=oran&limit=5", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if received.Text != "oran" || received.Limit != 5 {
+		t.Errorf("unexpected search query %+v", received)
+	}
+
+	var results []models.SearchResult
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response %v", err)
+	}
+	if len(results) != 1 || results[0].Snippet != "<mark>Orange</mark> Juice" || results[0].Product.ID != 1 {
+		t.Errorf("unexpected search results %+v", results)
+	}
+}
+
+func TestSearchProducts_InvalidQuery(t *testing.T) {
+	handler := handlers.ProductHandler{Repo: &repository.MockManualProductRepository{}}
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for _, query := range []string{"", "q=", "q=%3F%21", "q=juice&limit=0", "q=juice&sort=name"} {
+		req, _ := http.NewRequest("GET", "/products/search?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%q: expected status code %d, got %d", query, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestSearchProducts_MemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	repo.InsertProduct(context.Background(), models.Product{Name: "Orange Juice", Price: usd("3")})
+	repo.InsertProduct(context.Background(), models.Product{Name: "Grape", Price: usd("2")})
+
+	handler := handlers.ProductHandler{Repo: repo}
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req, _ := http.NewRequest("GET", "/products/search?q=juice", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `"name":"Orange Juice"`) || strings.Contains(body, "Grape") {
+		t.Errorf("unexpected search response %s", body)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+func putSKU(sku, body string) *http.Request {
+	req, _ := http.NewRequest("PUT", "/products/sku/"+sku, strings.NewReader(body))
+	return req
+}
+
+func TestUpsertProductBySKU(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+
+	rr := serve(repo, putSKU("TEA-1", `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`))
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "/products/1" {
+		t.Fatalf("expected the product to be created, got %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	var created models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created.SKU != "TEA-1" || created.Version != 1 {
+		t.Fatalf("unexpected created product %v: %v", created, err)
+	}
+	if rr.Header().Get("ETag") != handlers.ETag(created) {
+		t.Errorf("expected the ETag of the created product, got %q", rr.Header().Get("ETag"))
+	}
+
+	rr = serve(repo, putSKU("TEA-1", `{"sku":"TEA-1","name":"Green tea","price":{"amount":"3","currency":"EUR"}}`))
+	var replaced models.Product
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&replaced) != nil || replaced.ID != created.ID || replaced.Name != "Green tea" || replaced.Version != 2 {
+		t.Fatalf("expected the product to be replaced, got %d %v", rr.Code, replaced)
+	}
+
+	req, _ := http.NewRequest("GET", "/products/sku/TEA-1", nil)
+	rr = serve(repo, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != handlers.ETag(replaced) {
+		t.Errorf("expected the replaced product by its SKU, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpsertProductBySKU_IfMatch(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+
+	req := putSKU("TEA-1", `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`)
+	req.Header.Set("If-Match", `"1"`)
+	if rr := serve(repo, req); rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected If-Match to fail on a missing product, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	stale := serve(repo, putSKU("TEA-1", `{"name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`)).Header().Get("ETag")
+	current := serve(repo, putSKU("TEA-1", `{"name":"Tea","price":{"amount":"3","currency":"EUR"}}`)).Header().Get("ETag")
+
+	req = putSKU("TEA-1", `{"name":"Tea","price":{"amount":"4","currency":"EUR"}}`)
+	req.Header.Set("If-Match", stale)
+	if rr := serve(repo, req); rr.Code != http.StatusPreconditionFailed || !strings.Contains(rr.Body.String(), `"code":"precondition_failed"`) {
+		t.Errorf("expected a stale If-Match to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+	req = putSKU("TEA-1", `{"name":"Tea","price":{"amount":"4","currency":"EUR"}}`)
+	req.Header.Set("If-Match", current)
+	if rr := serve(repo, req); rr.Code != http.StatusOK {
+		t.Errorf("expected the current If-Match to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpsertProductBySKU_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sku      string
+		body     string
+		expected int
+		code     string
+	}{
+		{"OtherSKU", "TEA-1", `{"sku":"TEA-2","name":"Tea","price":{"amount":"2","currency":"EUR"}}`, http.StatusUnprocessableEntity, `"code":"immutable_field"`},
+		{"InvalidSKU", "-tea", `{"name":"Tea","price":{"amount":"2","currency":"EUR"}}`, http.StatusBadRequest, `"field":"/sku","code":"invalid_format"`},
+		{"MissingName", "TEA-1", `{"price":{"amount":"2","currency":"EUR"}}`, http.StatusBadRequest, `"field":"/name","code":"required"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := repository.NewMemoryProductRepository()
+			rr := serve(repo, putSKU(tc.sku, tc.body))
+			if rr.Code != tc.expected || !strings.Contains(rr.Body.String(), tc.code) {
+				t.Errorf("expected %d with %s, got %d %s", tc.expected, tc.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateProduct_DuplicateSKU(t *testing.T) {
+	repo := repository.NewMemoryProductRepository()
+	body := `{"sku":"TEA-1","name":"Tea","price":{"amount":"2.50","currency":"EUR"}}`
+
+	if rr := serve(repo, createRequest("", "", body)); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected first insert %d %s", rr.Code, rr.Body.String())
+	}
+	rr := serve(repo, createRequest("", "", body))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), `"code":"product_conflict"`) {
+		t.Errorf("expected a 409 for a taken SKU, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetProductBySKU_NotFound(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/sku/NONE", nil)
+	rr := serve(repository.NewMemoryProductRepository(), req)
+
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), `"code":"product_not_found"`) {
+		t.Errorf("expected a 404, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MaxXLSXRows is the number of rows a spreadsheet can hold.
+const MaxXLSXRows = 1 << 20
+
+// The parts of a workbook with a single sheet, apart from the sheet itself.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// xlsxCell is a cell value, written as a number when Number is set and as
+// text otherwise.
+type xlsxCell struct {
+	Value  string
+	Number bool
+}
+
+// xlsxWriter streams a workbook with a single sheet. Rows go straight into
+// the compressed sheet, so memory does not grow with their number. Strings
+// are written inline rather than in a shared table for the same reason.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	x := &xlsxWriter{zip: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		f, err := x.zip.Create(part.name)
+		if err != nil {
+			x.err = err
+			return x
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			x.err = err
+			return x
+		}
+	}
+
+	f, err := x.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		x.err = err
+		return x
+	}
+	x.sheet = bufio.NewWriterSize(f, 32<<10)
+	x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+func (x *xlsxWriter) WriteRow(cells []xlsxCell) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.rows == MaxXLSXRows {
+		x.err = fmt.Errorf("a spreadsheet holds at most %d rows", MaxXLSXRows)
+		return x.err
+	}
+	x.rows++
+
+	x.sheet.WriteString(`<row r="` + strconv.Itoa(x.rows) + `">`)
+	for _, cell := range cells {
+		if cell.Number {
+			x.sheet.WriteString(`<c><v>` + cell.Value + `</v></c>`)
+			continue
+		}
+		x.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		// EscapeText also replaces the characters XML cannot hold
+		xml.EscapeText(x.sheet, []byte(cell.Value))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, x.err = x.sheet.WriteString(`</row>`)
+	return x.err
+}
+
+// Close ends the sheet and the workbook. It does not close the underlying
+// writer.
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
@@ -0,0 +1,56 @@
+// Package idempotency remembers the responses of requests sent with an
+// Idempotency-Key header, so that a client retrying a request gets the first
+// response back instead of repeating its effect.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrMismatch means the key was first used for another request.
+	ErrMismatch = errors.New("idempotency key used for another request")
+	// ErrInProgress means the first request with the key has not completed.
+	ErrInProgress = errors.New("idempotency key in use by a request in progress")
+)
+
+// DefaultTTL is how long keys are remembered when the configuration does
+// not tell.
+const DefaultTTL = 24 * time.Hour
+
+// Response is a stored response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store keeps the keys of the requests in progress and the responses of the
+// completed ones. Keys are forgotten once their TTL has passed.
+type Store interface {
+	// Begin reserves key for a request with fingerprint. It returns the stored
+	// response when the key was already used for the same request, and
+	// ErrMismatch or ErrInProgress when the key cannot be used.
+	Begin(ctx context.Context, key, fingerprint string) (*Response, error)
+	// Complete stores the response of the request that reserved key.
+	Complete(ctx context.Context, key string, resp Response) error
+	// Release forgets a key reserved by Begin, for a request that should be
+	// retried rather than replayed.
+	Release(ctx context.Context, key string) error
+	// DeleteExpired forgets the keys older than the TTL and returns how many
+	// there were.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// Fingerprint identifies a request by its method, path and body.
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
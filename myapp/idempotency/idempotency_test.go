@@ -0,0 +1,128 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/migrations"
+	_ "github.com/lib/pq"
+)
+
+// testStore checks the behavior every Store shares.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+	created := Response{Status: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"id":1}`)}
+
+	t.Run("Replay", func(t *testing.T) {
+		s := newStore(t)
+		if resp, err := s.Begin(ctx, "k1", "a"); resp != nil || err != nil {
+			t.Fatalf("expected a new key, got %v %v", resp, err)
+		}
+		if _, err := s.Begin(ctx, "k1", "a"); !errors.Is(err, ErrInProgress) {
+			t.Errorf("expected ErrInProgress, got %v", err)
+		}
+		if err := s.Complete(ctx, "k1", created); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		resp, err := s.Begin(ctx, "k1", "a")
+		if err != nil || resp == nil {
+			t.Fatalf("expected the stored response, got %v %v", resp, err)
+		}
+		if resp.Status != created.Status || string(resp.Body) != string(created.Body) || resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+		if _, err := s.Begin(ctx, "k1", "b"); !errors.Is(err, ErrMismatch) {
+			t.Errorf("expected ErrMismatch, got %v", err)
+		}
+		if resp, err := s.Begin(ctx, "k2", "b"); resp != nil || err != nil {
+			t.Errorf("expected keys to be independent, got %v %v", resp, err)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		s := newStore(t)
+		s.Begin(ctx, "k1", "a")
+		if err := s.Release(ctx, "k1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp, err := s.Begin(ctx, "k1", "b"); resp != nil || err != nil {
+			t.Errorf("expected a released key to be free, got %v %v", resp, err)
+		}
+
+		// a completed key is kept
+		s.Complete(ctx, "k1", created)
+		s.Release(ctx, "k1")
+		if resp, err := s.Begin(ctx, "k1", "b"); resp == nil || err != nil {
+			t.Errorf("expected the response to outlive Release, got %v %v", resp, err)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore(time.Hour) })
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return clock }
+
+	s.Begin(ctx, "k1", "a")
+	s.Complete(ctx, "k1", Response{Status: http.StatusOK})
+	s.Begin(ctx, "k2", "a")
+
+	clock = clock.Add(time.Hour)
+	if resp, err := s.Begin(ctx, "k1", "b"); resp != nil || err != nil {
+		t.Errorf("expected an expired key to be taken over, got %v %v", resp, err)
+	}
+	if deleted, _ := s.DeleteExpired(ctx); deleted != 1 {
+		t.Errorf("expected the other expired key to be deleted, got %d", deleted)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("POST", "/products", []byte(`{"name":"Tea"}`))
+	if a != Fingerprint("POST", "/products", []byte(`{"name":"Tea"}`)) {
+		t.Error("expected the same request to have the same fingerprint")
+	}
+	if a == Fingerprint("POST", "/products", []byte(`{"name":"Milk"}`)) || a == Fingerprint("POST", "/products/bulk", []byte(`{"name":"Tea"}`)) {
+		t.Error("expected other requests to have other fingerprints")
+	}
+}
+
+// TestPostgresStore runs the store tests against the database in
+// TEST_DATABASE_URL. The idempotency_keys table is emptied.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+
+	testStore(t, func(t *testing.T) Store {
+		if _, err := db.Exec(`TRUNCATE idempotency_keys`); err != nil {
+			t.Fatalf("could not truncate idempotency_keys: %v", err)
+		}
+		return &PostgresStore{DB: db, TTL: time.Hour}
+	})
+}
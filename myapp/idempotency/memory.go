@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	fingerprint string
+	// response is nil while the request is in progress.
+	response  *Response
+	createdAt time.Time
+}
+
+// MemoryStore keeps keys in memory, for a single instance of the server.
+type MemoryStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore returns a store remembering keys for ttl. Zero means
+// DefaultTTL.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{ttl: ttl, now: time.Now, entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if ok && !s.expired(entry) {
+		switch {
+		case entry.fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case entry.response == nil:
+			return nil, ErrInProgress
+		}
+		resp := copyResponse(*entry.response)
+		return &resp, nil
+	}
+
+	s.entries[key] = memoryEntry{fingerprint: fingerprint, createdAt: s.now()}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		stored := copyResponse(resp)
+		entry.response = &stored
+		s.entries[key] = entry
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && entry.response == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, entry := range s.entries {
+		if s.expired(entry) {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) expired(entry memoryEntry) bool {
+	return !s.now().Before(entry.createdAt.Add(s.ttl))
+}
+
+// copyResponse keeps the stored responses apart from the ones handed out.
+func copyResponse(resp Response) Response {
+	resp.Header = resp.Header.Clone()
+	resp.Body = append([]byte(nil), resp.Body...)
+	return resp
+}
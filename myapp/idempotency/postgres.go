@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PostgresStore keeps keys in the idempotency_keys table, shared by every
+// instance of the server.
+type PostgresStore struct {
+	DB *sql.DB
+	// TTL is how long keys are remembered. Zero means DefaultTTL.
+	TTL time.Duration
+	// QueryTimeout bounds every query. Zero means no timeout.
+	QueryTimeout time.Duration
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.QueryTimeout)
+}
+
+func (s *PostgresStore) ttl() int64 {
+	if s.TTL <= 0 {
+		return DefaultTTL.Microseconds()
+	}
+	return s.TTL.Microseconds()
+}
+
+// maxBeginAttempts bounds the retries of Begin when the key it conflicted
+// with is released before it could be read.
+const maxBeginAttempts = 3
+
+func (s *PostgresStore) Begin(ctx context.Context, key, fingerprint string) (*Response, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		// an expired key is taken over as if it were new
+		var reserved bool
+		err := s.DB.QueryRowContext(ctx, `
+			INSERT INTO idempotency_keys (key, fingerprint) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE
+				SET fingerprint = EXCLUDED.fingerprint, status = NULL, header = NULL, body = NULL, created_at = now()
+				WHERE idempotency_keys.created_at <= now() - $3::bigint * interval '1 microsecond'
+			RETURNING true`, key, fingerprint, s.ttl()).Scan(&reserved)
+		if err == nil {
+			return nil, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		var stored string
+		var status sql.NullInt64
+		var header, body []byte
+		err = s.DB.QueryRowContext(ctx, `SELECT fingerprint, status, header, body FROM idempotency_keys WHERE key = $1`, key).
+			Scan(&stored, &status, &header, &body)
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && attempt < maxBeginAttempts:
+			continue
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrInProgress
+		case err != nil:
+			return nil, err
+		case stored != fingerprint:
+			return nil, ErrMismatch
+		case !status.Valid:
+			return nil, ErrInProgress
+		}
+
+		resp := &Response{Status: int(status.Int64), Header: http.Header{}, Body: body}
+		if err := json.Unmarshal(header, &resp.Header); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key string, resp Response) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `UPDATE idempotency_keys SET status = $2, header = $3, body = $4 WHERE key = $1`,
+		key, resp.Status, header, resp.Body)
+	return err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL`, key)
+	return err
+}
+
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at <= now() - $1::bigint * interval '1 microsecond'`, s.ttl())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,120 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSON(t *testing.T, name string, got []byte, expected string) {
+	t.Helper()
+
+	var g, e interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: invalid result %s: %v", name, got, err)
+	}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("%s: invalid expectation %s: %v", name, expected, err)
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("%s: expected %s, got %s", name, expected, got)
+	}
+}
+
+// Examples from RFC 7396, appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct{ doc, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s + %s: unexpected error: %v", tt.doc, tt.patch, err)
+		}
+		assertJSON(t, tt.doc+" + "+tt.patch, got, tt.expected)
+	}
+}
+
+func TestMergePatch_Invalid(t *testing.T) {
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("expected ErrInvalidPatch, got %v", err)
+	}
+}
+
+// Examples from RFC 6902, appendix A.
+func TestApply(t *testing.T) {
+	tests := []struct{ name, doc, patch, expected string }{
+		{"add object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"remove object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"test success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"add nested object", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"add to array end", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{"nested arrays", `[[1,2],[3]]`, `[{"op":"add","path":"/0/1","value":9}]`, `[[1,9,2],[3]]`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, tt := range tests {
+		got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		assertJSON(t, tt.name, got, tt.expected)
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+		expected         error
+	}{
+		{"not an array", `{}`, `{"op":"add"}`, ErrInvalidPatch},
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a"}]`, ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, ErrInvalidPatch},
+		{"relative path", `{}`, `[{"op":"add","path":"a","value":1}]`, ErrInvalidPatch},
+		{"missing member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ErrCannotApply},
+		{"remove missing", `{}`, `[{"op":"remove","path":"/a"}]`, ErrCannotApply},
+		{"index out of range", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":1}]`, ErrCannotApply},
+		{"leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`, ErrCannotApply},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ErrCannotApply},
+		{"test failure", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ErrTestFailed},
+		{"number is not string", `{"baz":"1"}`, `[{"op":"test","path":"/baz","value":1}]`, ErrTestFailed},
+	}
+
+	for _, tt := range tests {
+		if _, err := Apply([]byte(tt.doc), []byte(tt.patch)); !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestApply_Atomic(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	if _, err := Apply(doc, []byte(`[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":3}]`)); err == nil {
+		t.Fatal("expected the patch to fail")
+	}
+	if string(doc) != `{"a":1}` {
+		t.Errorf("expected the original document to be untouched, got %s", doc)
+	}
+}
@@ -1,38 +1,138 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/bda-mota/MyFirstCRUD/myapp/config"
 	"github.com/bda-mota/MyFirstCRUD/myapp/handlers"
+	"github.com/bda-mota/MyFirstCRUD/myapp/idempotency"
 	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	r := mux.NewRouter()
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path to a YAML configuration file")
+	storage := flag.String("storage", "", "product storage backend: postgres or memory (overrides the configuration)")
+	autoMigrate := flag.Bool("migrate", true, "apply pending database migrations on startup (overrides the configuration)")
+	flag.Parse()
 
-	db, err := config.OpenConn()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Could not connect to the database: %v", err)
+		log.Fatalf("Could not load configuration: %v", err)
+	}
+	// flags override the file and the environment, and only the result has
+	// to be valid
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "storage":
+			cfg.Storage = *storage
+		case "migrate":
+			cfg.Database.AutoMigrate = *autoMigrate
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Could not load configuration: %v", err)
 	}
-	defer db.Close()
+	log.Printf("Configuration: %s", cfg)
 
-	productRepo := &repository.PostgresProductRepository{DB: db}
-	productHandler := &handlers.ProductHandler{Repo: productRepo}
+	if flag.Arg(0) == "migrate" {
+		db, err := config.OpenConn(cfg.Database)
+		if err != nil {
+			log.Fatalf("Could not connect to the database: %v", err)
+		}
+		defer db.Close()
 
-	r.HandleFunc("/products", productHandler.CreateProduct).Methods("POST")
-	r.HandleFunc("/products/list", productHandler.GetAllProducts).Methods("GET")
-	r.HandleFunc("/products/{id}", productHandler.GetProductByID).Methods("GET")
-	r.HandleFunc("/products/{id}", productHandler.DeleteProductByID).Methods("DELETE")
-	r.HandleFunc("/products/{id}", productHandler.UpdateProductByID).Methods("PUT")
+		if err := runMigrate(context.Background(), db, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
 
-	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Route not found", http.StatusNotFound)
-	})
+	r := mux.NewRouter()
+
+	var productRepo repository.ProductRepository
+	var idempotencyKeys idempotency.Store
+	switch cfg.Storage {
+	case "postgres":
+		db, err := config.OpenConn(cfg.Database)
+		if err != nil {
+			log.Fatalf("Could not connect to the database: %v", err)
+		}
+		defer db.Close()
+
+		if cfg.Database.AutoMigrate {
+			if err := runMigrate(context.Background(), db, []string{"up"}); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+		}
+
+		productRepo = &repository.PostgresProductRepository{DB: db, QueryTimeout: cfg.Database.QueryTimeout}
+		if cfg.Idempotency.TTL > 0 {
+			idempotencyKeys = &idempotency.PostgresStore{DB: db, TTL: cfg.Idempotency.TTL, QueryTimeout: cfg.Database.QueryTimeout}
+		}
+	case "memory":
+		productRepo = repository.NewMemoryProductRepository()
+		if cfg.Idempotency.TTL > 0 {
+			idempotencyKeys = idempotency.NewMemoryStore(cfg.Idempotency.TTL)
+		}
+	}
+	productHandler := &handlers.ProductHandler{
+		Repo:          productRepo,
+		AdminToken:    cfg.Admin.Token,
+		ProxyToken:    cfg.Proxy.Token,
+		ImportTimeout: cfg.Server.ImportTimeout,
+		BulkTimeout:   cfg.Server.BulkTimeout,
+		ExportTimeout: cfg.Server.ExportTimeout,
+		Idempotency:   idempotencyKeys,
+	}
 
-	fmt.Println("Host on door 8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	productHandler.RegisterRoutes(r)
+
+	server := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Purge.Interval > 0 {
+		go purgeDeleted(ctx, productRepo, cfg.Purge)
+	}
+	if idempotencyKeys != nil {
+		go expireIdempotencyKeys(ctx, idempotencyKeys, cfg.Idempotency.TTL)
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Could not shut down cleanly: %v", err)
+		}
+	}()
+
+	log.Printf("Listening on %s using %s storage", cfg.Server.Addr, cfg.Storage)
+	if cfg.Server.TLS.Enabled() {
+		err = server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdown
 }
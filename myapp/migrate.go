@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/migrations"
+)
+
+const migrateUsage = "usage: myapp migrate [up | down [steps] | status]"
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch {
+	case command == "up" && len(args) <= 1:
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+	case command == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q\n%s", args[1], migrateUsage)
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case command == "status" && len(args) <= 1:
+		statuses, err := m.Status(ctx)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return err
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,278 @@
+// Package migrations keeps the database schema up to date. Migrations are
+// versioned SQL files embedded in the binary, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// lockID identifies the advisory lock held while migrations run, so two
+// instances starting at the same time never apply the same migration.
+const lockID int64 = 0x6d79617070
+
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads the migrations in the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected file %q in migrations", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator applies migrations to a Postgres database.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New returns a Migrator for the migrations embedded in the binary.
+func New(db *sql.DB) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("could not apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		for i := len(m.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.Migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted: no down file", migration.Version, migration.Name)
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("could not revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status reports which migrations have been applied.
+func (m *Migrator) Status(ctx context.Context) (statuses []Status, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		for _, migration := range m.Migrations {
+			applied, ok := done[migration.Version]
+			statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: applied.at})
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+type appliedMigration struct {
+	checksum string
+	at       time.Time
+}
+
+// locked runs fn on a single connection holding the migrations advisory
+// lock, after checking the applied migrations against the known ones.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, done map[int64]appliedMigration) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("could not acquire migrations lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("could not create schema_migrations: %w", err)
+	}
+
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, done)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var applied appliedMigration
+		if err := rows.Scan(&version, &applied.checksum, &applied.at); err != nil {
+			return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+		}
+		done[version] = applied
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+	}
+
+	return done, verify(m.Migrations, done)
+}
+
+// verify fails when an applied migration was edited or removed afterwards.
+func verify(migrations []Migration, done map[int64]appliedMigration) error {
+	known := make(map[int64]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, applied := range done {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("applied migration %d is unknown to this binary", version)
+		}
+		if migration.Checksum != applied.checksum {
+			return fmt.Errorf("%w: %d_%s was changed after being applied", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
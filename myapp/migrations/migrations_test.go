@@ -0,0 +1,127 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/lib/pq"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_column.up.sql":       {Data: []byte("ALTER TABLE t ADD COLUMN c INT;")},
+		"0001_create_table.up.sql":     {Data: []byte("CREATE TABLE t (id INT);")},
+		"0001_create_table.down.sql":   {Data: []byte("DROP TABLE t;")},
+		"0002_add_column.down.sql":     {Data: []byte("ALTER TABLE t DROP COLUMN c;")},
+		"0003_without_rollback.up.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(migrations) != 3 {
+		t.Fatalf("expected 3 migrations, got %d", len(migrations))
+	}
+	for i, name := range []string{"create_table", "add_column", "without_rollback"} {
+		if migrations[i].Version != int64(i+1) || migrations[i].Name != name {
+			t.Errorf("expected migration %d_%s at position %d, got %d_%s", i+1, name, i, migrations[i].Version, migrations[i].Name)
+		}
+	}
+	if migrations[0].Down != "DROP TABLE t;" {
+		t.Errorf("expected down SQL to be loaded, got %q", migrations[0].Down)
+	}
+	if migrations[0].Checksum == "" || migrations[0].Checksum == migrations[1].Checksum {
+		t.Errorf("expected distinct checksums, got %q and %q", migrations[0].Checksum, migrations[1].Checksum)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing up": {
+			"0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		},
+		"bad file name": {
+			"create_table.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+		},
+		"conflicting names": {
+			"0001_create_table.up.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+			"0001_other.down.sql":      {Data: []byte("DROP TABLE t;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNew_Embedded(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatalf("embedded migrations do not load: %v", err)
+	}
+	if len(m.Migrations) == 0 || m.Migrations[0].Version != 1 {
+		t.Errorf("expected embedded migrations to start at version 1, got %v", m.Migrations)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "create_table", Checksum: "abc"}}
+
+	if err := verify(migrations, map[int64]appliedMigration{1: {checksum: "abc"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verify(migrations, map[int64]appliedMigration{1: {checksum: "changed"}}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if err := verify(migrations, map[int64]appliedMigration{2: {checksum: "abc"}}); err == nil {
+		t.Errorf("expected an error for an unknown applied migration")
+	}
+}
+
+// TestMigrator_Postgres applies the embedded migrations to the database in
+// TEST_DATABASE_URL. It never reverts them, since other packages run their
+// tests against the same schema.
+func TestMigrator_Postgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("expected a second up to be a no-op, got %v, %v", applied, err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("expected migration %d_%s to be applied", status.Version, status.Name)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE products
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS product_audit;
+
+DROP FUNCTION IF EXISTS product_audit_append_only();
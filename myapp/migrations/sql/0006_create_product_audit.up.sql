@@ -0,0 +1,23 @@
+CREATE TABLE product_audit (
+    id         BIGSERIAL PRIMARY KEY,
+    -- no foreign key: the history outlives purged products
+    product_id BIGINT      NOT NULL,
+    action     TEXT        NOT NULL,
+    actor      TEXT        NOT NULL,
+    request_id TEXT        NOT NULL DEFAULT '',
+    before     JSONB,
+    after      JSONB,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX product_audit_product_id_idx ON product_audit (product_id, id);
+
+CREATE FUNCTION product_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'product_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER product_audit_append_only
+    BEFORE UPDATE OR DELETE ON product_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION product_audit_append_only();
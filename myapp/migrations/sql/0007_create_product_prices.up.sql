@@ -0,0 +1,15 @@
+CREATE TABLE product_prices (
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT           NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    price      DOUBLE PRECISION NOT NULL,
+    valid_from TIMESTAMPTZ      NOT NULL,
+    -- NULL while the price is current
+    valid_to   TIMESTAMPTZ,
+    CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX product_prices_product_id_idx ON product_prices (product_id, valid_from);
+CREATE UNIQUE INDEX product_prices_current_idx ON product_prices (product_id) WHERE valid_to IS NULL;
+
+INSERT INTO product_prices (product_id, price, valid_from)
+SELECT id, price, created_at FROM products;
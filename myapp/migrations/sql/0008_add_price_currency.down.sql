@@ -0,0 +1,13 @@
+ALTER TABLE product_audit DISABLE TRIGGER product_audit_append_only;
+UPDATE product_audit SET
+    before = jsonb_set(before, '{price}', to_jsonb((before->'price'->>'amount')::double precision)),
+    after = jsonb_set(after, '{price}', to_jsonb((after->'price'->>'amount')::double precision));
+ALTER TABLE product_audit ENABLE TRIGGER product_audit_append_only;
+
+ALTER TABLE product_prices
+    DROP COLUMN IF EXISTS currency,
+    ALTER COLUMN price TYPE DOUBLE PRECISION;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS currency,
+    ALTER COLUMN price TYPE DOUBLE PRECISION;
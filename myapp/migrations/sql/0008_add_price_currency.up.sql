@@ -0,0 +1,19 @@
+-- Prices become exact decimals with an ISO 4217 currency. Existing prices had
+-- no currency and are taken to be in US dollars.
+ALTER TABLE products
+    ALTER COLUMN price TYPE NUMERIC(19, 4) USING round(price::numeric, 4),
+    ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE product_prices
+    ALTER COLUMN price TYPE NUMERIC(19, 4) USING round(price::numeric, 4),
+    ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE product_prices ALTER COLUMN currency DROP DEFAULT;
+
+-- the audit snapshots are in the JSON form of the API, so their prices are
+-- rewritten once to {"amount": "...", "currency": "USD"}
+ALTER TABLE product_audit DISABLE TRIGGER product_audit_append_only;
+UPDATE product_audit SET
+    before = jsonb_set(before, '{price}', jsonb_build_object('amount', round((before->>'price')::numeric, 4)::text, 'currency', 'USD')),
+    after = jsonb_set(after, '{price}', jsonb_build_object('amount', round((after->>'price')::numeric, 4)::text, 'currency', 'USD'));
+ALTER TABLE product_audit ENABLE TRIGGER product_audit_append_only;
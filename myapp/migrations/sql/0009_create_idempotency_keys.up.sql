@@ -0,0 +1,12 @@
+-- status, header and body stay NULL while the first request with the key is
+-- in progress
+CREATE TABLE idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    fingerprint TEXT        NOT NULL,
+    status      INTEGER,
+    header      JSONB,
+    body        BYTEA,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
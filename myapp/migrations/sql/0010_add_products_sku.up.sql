@@ -0,0 +1,5 @@
+-- SKUs are optional, so existing products get none. A deleted product gives
+-- its SKU up, and cannot be restored while another product uses it.
+ALTER TABLE products ADD COLUMN sku TEXT CHECK (sku <> '');
+
+CREATE UNIQUE INDEX products_sku_key ON products (sku) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE product_audit DROP COLUMN IF EXISTS claimed_actor;
@@ -0,0 +1,2 @@
+-- the X-Actor of a request that did not prove it, kept apart from actor
+ALTER TABLE product_audit ADD COLUMN claimed_actor TEXT NOT NULL DEFAULT '';
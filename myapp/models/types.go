@@ -1,12 +1,134 @@
 package models
 
+import (
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/validate"
+)
+
+// Product is checked with validate.Struct before it is stored. The rules that
+// involve more than one field are in Check.
 type Product struct {
-	ID    int64   `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	ID int64 `json:"id" validate:"min=0"`
+	// SKU is the stock keeping unit, which no two live products share. It is
+	// optional, and made of letters, digits, dots, dashes and underscores.
+	SKU string `json:"sku,omitempty" validate:"max=64,pattern=^[A-Za-z0-9][A-Za-z0-9._-]*$"`
+	// Name has at most 200 characters, not all of them white space, and no
+	// control characters such as line breaks.
+	Name  string      `json:"name" validate:"required,notblank,max=200,pattern=^\\P{Cc}*$"`
+	Price money.Money `json:"price" validate:"required"`
+	// Version starts at 1 and grows with every update of the product.
+	Version int64 `json:"version" validate:"min=0"`
+	// CreatedAt and UpdatedAt are set by the repository; values sent by
+	// clients are ignored.
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// DeletedAt is set once the product is deleted. Deleted products are only
+	// shown to admins until they are restored or purged.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Check validates the price: its amount must fit the minor units of its
+// currency, e.g. no cents in JPY, and be positive. A missing price is left to
+// the required rule.
+func (p Product) Check() validate.Errors {
+	if p.Price == (money.Money{}) {
+		return nil
+	}
+	if err := p.Price.Validate(); err != nil {
+		return validate.Errors{{Field: "/price", Code: "invalid_money", Message: err.Error()}}
+	}
+	if p.Price.Amount <= 0 {
+		return validate.Errors{{Field: "/price/amount", Code: "not_positive", Message: "Price must be greater than 0"}}
+	}
+	return nil
+}
+
+// SearchResult is a product matching a full-text search. Snippet is the
+// HTML-escaped product name with the matched words wrapped in <mark> tags.
+type SearchResult struct {
+	Product Product `json:"product"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// PricePeriod is a price and the time range during which it applied. ValidTo
+// is nil for the current price.
+type PricePeriod struct {
+	Price     money.Money `json:"price"`
+	ValidFrom time.Time   `json:"validFrom"`
+	ValidTo   *time.Time  `json:"validTo"`
+}
+
+// AuditEntry records one change of a product. Before is nil for a creation
+// and After is nil once the product is purged.
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	ProductID int64  `json:"productId"`
+	Action    string `json:"action"`
+	Actor     string `json:"actor"`
+	// ClaimedActor is the unverified X-Actor sent with the change, if any.
+	ClaimedActor string    `json:"claimedActor,omitempty"`
+	RequestID    string    `json:"requestId,omitempty"`
+	Before       *Product  `json:"before"`
+	After        *Product  `json:"after"`
+	ChangedAt    time.Time `json:"changedAt"`
+}
+
+// BulkReport lists the outcome of every item of a bulk request, in request
+// order.
+type BulkReport struct {
+	Atomic    bool         `json:"atomic"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// BulkResult is the outcome of one item of a bulk request. Status is the
+// HTTP status the item would have had as a request of its own.
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	ID     int64  `json:"id,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport counts the outcomes of an import. Errors lists the lines that
+// were not imported, in line order.
+type ImportReport struct {
+	DryRun    bool          `json:"dryRun"`
+	Created   int           `json:"created"`
+	Updated   int           `json:"updated"`
+	Unchanged int           `json:"unchanged"`
+	Failed    int           `json:"failed"`
+	Errors    []ImportError `json:"errors"`
+}
+
+// ImportError is a line of an import that was not imported.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Problem is an error response in the RFC 7807 problem details format.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code names the kind of error for programs, see the handlers package.
+	Code string `json:"code"`
+	// Errors lists the invalid fields of a request body, when known.
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
-type RequestError struct {
-	Message   string `json:"error"`
-	ErrorCode int    `json:"errorCode"`
+// FieldError is an invalid value in a request body. Field is a JSON Pointer
+// to the value, such as /price/amount.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
@@ -0,0 +1,210 @@
+// Package money represents prices as fixed-point amounts in an ISO 4217
+// currency, so that they add up exactly, unlike float64.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places kept by an Amount. It covers the
+// minor units of every ISO 4217 currency.
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+// ErrInvalid means an amount or a currency is malformed or the amount does
+// not fit the minor units of its currency.
+var ErrInvalid = errors.New("invalid money")
+
+// Amount is a decimal number with Scale decimal places, stored as a count of
+// 1/10^Scale. It is written to Postgres as a NUMERIC.
+type Amount int64
+
+// ParseAmount reads a decimal such as "19.99" or "-3". Exponents and more
+// than Scale decimal places are rejected rather than rounded.
+func ParseAmount(s string) (Amount, error) {
+	digits := strings.TrimPrefix(s, "-")
+	negative := len(digits) < len(s)
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(frac) || strings.HasSuffix(digits, ".") {
+		return 0, fmt.Errorf("%w: amount %q is not a decimal number", ErrInvalid, s)
+	}
+	if len(frac) > Scale {
+		return 0, fmt.Errorf("%w: amount %q has more than %d decimal places", ErrInvalid, s, Scale)
+	}
+
+	n, err := strconv.ParseInt(whole+frac+strings.Repeat("0", Scale-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: amount %q is too large", ErrInvalid, s)
+	}
+	if negative {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// places is the number of decimal places needed to write a exactly.
+func (a Amount) places() int {
+	places := Scale
+	for n := a; places > 0 && n%10 == 0; n /= 10 {
+		places--
+	}
+	return places
+}
+
+// Format writes a with at least the given number of decimal places, and more
+// when a needs them.
+func (a Amount) Format(places int) string {
+	if p := a.places(); p > places {
+		places = p
+	}
+	if places > Scale {
+		places = Scale
+	}
+
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	s := fmt.Sprintf("%s%d", sign, n/unit)
+	if places > 0 {
+		s += fmt.Sprintf(".%04d", n%unit)[:places+1]
+	}
+	return s
+}
+
+func (a Amount) String() string {
+	return a.Format(0)
+}
+
+// Value writes a as the text of a NUMERIC.
+func (a Amount) Value() (driver.Value, error) {
+	return a.Format(Scale), nil
+}
+
+// Scan reads a NUMERIC, which lib/pq returns as text.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	case int64:
+		*a = Amount(v * unit)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanText(s string) error {
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Money is an amount in a currency.
+type Money struct {
+	Amount Amount
+	// Currency is an ISO 4217 code such as "EUR".
+	Currency string
+}
+
+// Parse reads an amount in a currency and validates it.
+func Parse(amount, currency string) (Money, error) {
+	a, err := ParseAmount(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	m := Money{Amount: a, Currency: currency}
+	return m, m.Validate()
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants and
+// tests.
+func MustParse(amount, currency string) Money {
+	m, err := Parse(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Validate checks that the currency is known and that the amount has no
+// more decimal places than the minor units of the currency, e.g. none for
+// JPY and three for KWD.
+func (m Money) Validate() error {
+	minor, ok := MinorUnits(m.Currency)
+	if !ok {
+		return fmt.Errorf("%w: currency must be an ISO 4217 code such as \"EUR\", got %q", ErrInvalid, m.Currency)
+	}
+	if m.Amount.places() > minor {
+		return fmt.Errorf("%w: %s amounts have at most %d decimal places, got %s", ErrInvalid, m.Currency, minor, m.Amount)
+	}
+	return nil
+}
+
+// String writes m with the minor units of its currency, e.g. "19.90 EUR".
+func (m Money) String() string {
+	minor, _ := MinorUnits(m.Currency)
+	return m.Amount.Format(minor) + " " + m.Currency
+}
+
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON writes m as {"amount":"19.90","currency":"EUR"}. The amount is
+// a string so that clients do not read it into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	minor, _ := MinorUnits(m.Currency)
+	amount, err := json.Marshal(m.Amount.Format(minor))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonMoney{Amount: amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON reads the form written by MarshalJSON. The currency is not
+// checked here; see Validate.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("%w: money must be an object with an amount and a currency", ErrInvalid)
+	}
+
+	var amount string
+	if err := json.Unmarshal(v.Amount, &amount); err != nil {
+		return fmt.Errorf("%w: amount must be a string such as \"19.99\"", ErrInvalid)
+	}
+	parsed, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+
+	*m = Money{Amount: parsed, Currency: v.Currency}
+	return nil
+}
@@ -0,0 +1,108 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	for input, expected := range map[string]Amount{
+		"0": 0, "19.99": 199900, "-3": -30000, "0.0001": 1, "007.50": 75000, "922337203685477.5807": 9223372036854775807,
+	} {
+		if got, err := ParseAmount(input); err != nil || got != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", input, expected, got, err)
+		}
+	}
+
+	for _, input := range []string{"", "-", ".5", "1.", "1e3", "+1", "1,5", "0.00001", "1 ", "922337203685477.5808"} {
+		if _, err := ParseAmount(input); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid, got %v", input, err)
+		}
+	}
+}
+
+func TestAmountAddsUpExactly(t *testing.T) {
+	a, _ := ParseAmount("0.1")
+	b, _ := ParseAmount("0.2")
+	if sum := (a + b).String(); sum != "0.3" {
+		t.Errorf("expected 0.3, got %s", sum)
+	}
+}
+
+func TestAmountFormat(t *testing.T) {
+	for _, tc := range []struct {
+		amount   Amount
+		places   int
+		expected string
+	}{
+		{199900, 2, "19.99"},
+		{199000, 2, "19.90"},
+		{190000, 0, "19"},
+		{195000, 0, "19.5"},
+		{12345, 2, "1.2345"},
+		{-5000, 2, "-0.50"},
+		{0, 3, "0.000"},
+	} {
+		if got := tc.amount.Format(tc.places); got != tc.expected {
+			t.Errorf("%d with %d places: expected %s, got %s", tc.amount, tc.places, tc.expected, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, m := range []Money{
+		{Amount: 199900, Currency: "EUR"},
+		{Amount: 10000, Currency: "JPY"},
+		{Amount: 12340, Currency: "KWD"},
+	} {
+		if err := m.Validate(); err != nil {
+			t.Errorf("%v: unexpected error %v", m, err)
+		}
+	}
+
+	for _, m := range []Money{
+		{Amount: 199900, Currency: "eur"},
+		{Amount: 199900, Currency: ""},
+		{Amount: 199900, Currency: "XYZ"},
+		{Amount: 15000, Currency: "JPY"},
+		{Amount: 199990, Currency: "USD"},
+		{Amount: 12345, Currency: "KWD"},
+	} {
+		if err := m.Validate(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%v: expected ErrInvalid, got %v", m, err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(Money{Amount: 199000, Currency: "EUR"})
+	if err != nil || string(data) != `{"amount":"19.90","currency":"EUR"}` {
+		t.Errorf("unexpected JSON %s (%v)", data, err)
+	}
+	data, _ = json.Marshal(Money{Amount: 1000000, Currency: "JPY"})
+	if string(data) != `{"amount":"100","currency":"JPY"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`{"amount":"19.9","currency":"EUR"}`), &m); err != nil || m != (Money{Amount: 199000, Currency: "EUR"}) {
+		t.Errorf("unexpected money %v (%v)", m, err)
+	}
+
+	for _, input := range []string{`{"amount":19.9,"currency":"EUR"}`, `{"currency":"EUR"}`, `{"amount":"1e2","currency":"EUR"}`, `"19.90 EUR"`} {
+		if err := json.Unmarshal([]byte(input), &m); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", input, err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	var a Amount
+	if err := a.Scan([]byte("19.9900")); err != nil || a != 199900 {
+		t.Errorf("unexpected amount %d (%v)", a, err)
+	}
+	if v, _ := a.Value(); v != "19.9900" {
+		t.Errorf("unexpected value %v", v)
+	}
+}
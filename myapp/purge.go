@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/config"
+	"github.com/bda-mota/MyFirstCRUD/myapp/idempotency"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+// purgeDeleted removes the products deleted for longer than the retention
+// period, once per interval until ctx is done.
+func purgeDeleted(ctx context.Context, repo repository.ProductRepository, cfg config.PurgeConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := repo.PurgeDeletedProducts(ctx, time.Now().Add(-cfg.Retention))
+		if err != nil {
+			log.Printf("Could not purge deleted products: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted products", purged)
+		}
+	}
+}
+
+// expireIdempotencyKeys removes the expired idempotency keys once per ttl
+// until ctx is done, so that no key outlives twice its ttl.
+func expireIdempotencyKeys(ctx context.Context, keys idempotency.Store, ttl time.Duration) {
+	ticker := time.NewTicker(ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := keys.DeleteExpired(ctx)
+		if err != nil {
+			log.Printf("Could not delete expired idempotency keys: %v", err)
+		} else if expired > 0 {
+			log.Printf("Deleted %d expired idempotency keys", expired)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// HistoryOptions selects one page of a product history.
+type HistoryOptions struct {
+	// Limit caps the number of entries returned. Zero means no limit.
+	Limit int
+	// After, when not zero, starts the page right after the entry with this ID.
+	After int64
+}
+
+type HistoryPage struct {
+	Entries []models.AuditEntry
+	// Next is the ID of the last entry of the page when more entries follow.
+	Next int64
+}
+
+// newHistoryPage trims the limit+1 entries fetched by an implementation to
+// the requested limit, recording whether a next page exists.
+func newHistoryPage(entries []models.AuditEntry, opts HistoryOptions) HistoryPage {
+	page := HistoryPage{Entries: entries}
+	if page.Entries == nil {
+		page.Entries = []models.AuditEntry{}
+	}
+
+	if opts.Limit > 0 && len(page.Entries) > opts.Limit {
+		page.Entries = page.Entries[:opts.Limit]
+		page.Next = page.Entries[opts.Limit-1].ID
+	}
+	return page
+}
+
+// newAuditEntry describes a change made on behalf of the actor found in ctx.
+func newAuditEntry(ctx context.Context, action string, before, after *models.Product) models.AuditEntry {
+	info := audit.FromContext(ctx)
+	entry := models.AuditEntry{Action: action, Actor: info.Actor, ClaimedActor: info.ClaimedActor, RequestID: info.RequestID, Before: before, After: after}
+	if after != nil {
+		entry.ProductID = after.ID
+	} else {
+		entry.ProductID = before.ID
+	}
+	return entry
+}
+
+func (r *PostgresProductRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", classifyPgError(err))
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", classifyPgError(err))
+	}
+	return nil
+}
+
+// lockProduct reads a product and locks it until tx ends, so its audit entry
+// sees the exact values being replaced.
+func lockProduct(ctx context.Context, tx *sql.Tx, id int64, includeDeleted bool) (models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	var p models.Product
+	err := scanProduct(tx.QueryRowContext(ctx, query+` FOR UPDATE`, id), &p)
+	if err == sql.ErrNoRows {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	} else if err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", classifyPgError(err))
+	}
+	return p, nil
+}
+
+// recordChange keeps the audit log and the price history in step with a
+// change made in tx.
+func recordChange(ctx context.Context, tx *sql.Tx, action string, before, after *models.Product) error {
+	if err := recordAudit(ctx, tx, action, before, after); err != nil {
+		return err
+	}
+	if after != nil && (before == nil || before.Price != after.Price) {
+		return recordPrice(ctx, tx, *after)
+	}
+	return nil
+}
+
+// snapshot is the value of an audit snapshot column for p.
+func snapshot(p *models.Product) interface{} {
+	if p == nil {
+		return nil
+	}
+	// sent as text, lib/pq would encode a []byte as bytea
+	raw, _ := json.Marshal(p)
+	return string(raw)
+}
+
+// recordAudit appends the change from before to after to the audit log, in
+// the transaction making the change.
+func recordAudit(ctx context.Context, tx *sql.Tx, action string, before, after *models.Product) error {
+	entry := newAuditEntry(ctx, action, before, after)
+
+	sql := `INSERT INTO product_audit (product_id, action, actor, claimed_actor, request_id, before, after) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := tx.ExecContext(ctx, sql, entry.ProductID, entry.Action, entry.Actor, entry.ClaimedActor, entry.RequestID, snapshot(before), snapshot(after))
+	if err != nil {
+		return fmt.Errorf("could not record audit entry: %w", classifyPgError(err))
+	}
+	return nil
+}
+
+// HISTORY
+func (r *PostgresProductRepository) ListProductHistory(ctx context.Context, id int64, opts HistoryOptions) (HistoryPage, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var args queryArgs
+	query := `SELECT id, product_id, action, actor, claimed_actor, request_id, before, after, changed_at
+		FROM product_audit WHERE product_id = ` + args.add(id)
+	if opts.After != 0 {
+		query += ` AND id < ` + args.add(opts.After)
+	}
+	query += ` ORDER BY id DESC`
+	if opts.Limit > 0 {
+		// one more row tells whether a next page exists
+		query += ` LIMIT ` + args.add(opts.Limit+1)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return HistoryPage{}, fmt.Errorf("could not list product history: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after []byte
+
+		if err = rows.Scan(&e.ID, &e.ProductID, &e.Action, &e.Actor, &e.ClaimedActor, &e.RequestID, &before, &after, &e.ChangedAt); err != nil {
+			return HistoryPage{}, fmt.Errorf("could not read audit entry: %w", classifyPgError(err))
+		}
+		e.ChangedAt = e.ChangedAt.UTC()
+		for _, snapshot := range []struct {
+			raw []byte
+			dst **models.Product
+		}{{before, &e.Before}, {after, &e.After}} {
+			if snapshot.raw == nil {
+				continue
+			}
+			if err := json.Unmarshal(snapshot.raw, snapshot.dst); err != nil {
+				return HistoryPage{}, fmt.Errorf("could not read audit entry %d: %w", e.ID, err)
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return HistoryPage{}, fmt.Errorf("could not list product history: %w", classifyPgError(err))
+	}
+
+	return newHistoryPage(entries, opts), nil
+}
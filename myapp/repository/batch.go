@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// BatchResult is the outcome of one item of a batch. ID is the product the
+// item created or changed, and Err is nil when the item succeeded.
+type BatchResult struct {
+	ID  int64
+	Err error
+}
+
+// BatchError is returned by an atomic batch that failed, in which case
+// nothing of the batch is kept.
+type BatchError struct {
+	// Index is the position of the item that failed.
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// inBatch runs fn for each of n items in one transaction. In atomic mode the
+// first failure rolls everything back; otherwise every item runs under a
+// savepoint, so that a failure only undoes that item. There is no
+// QueryTimeout: a batch of many items takes longer than any single query,
+// and the bulk handlers bound ctx instead.
+func (r *PostgresProductRepository) inBatch(ctx context.Context, n int, atomic bool, fn func(tx *sql.Tx, i int) (int64, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, n)
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for i := range results {
+			if atomic {
+				id, err := fn(tx, i)
+				if err != nil {
+					return &BatchError{Index: i, Err: err}
+				}
+				results[i].ID = id
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_item`); err != nil {
+				return fmt.Errorf("could not start batch item: %w", classifyPgError(err))
+			}
+			id, err := fn(tx, i)
+			end := `RELEASE SAVEPOINT batch_item`
+			if err != nil {
+				end = `ROLLBACK TO SAVEPOINT batch_item; ` + end
+			}
+			if _, err := tx.ExecContext(ctx, end); err != nil {
+				return fmt.Errorf("could not end batch item: %w", classifyPgError(err))
+			}
+			results[i] = BatchResult{ID: id, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BATCH POST
+func (r *PostgresProductRepository) InsertProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return r.inBatch(ctx, len(products), atomic, func(tx *sql.Tx, i int) (int64, error) {
+		created, err := insertProduct(ctx, tx, products[i])
+		return created.ID, err
+	})
+}
+
+// BATCH PUT
+func (r *PostgresProductRepository) UpdateProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return r.inBatch(ctx, len(products), atomic, func(tx *sql.Tx, i int) (int64, error) {
+		_, err := updateProduct(ctx, tx, products[i].ID, products[i])
+		return products[i].ID, err
+	})
+}
+
+// BATCH DELETE
+func (r *PostgresProductRepository) DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]BatchResult, error) {
+	return r.inBatch(ctx, len(ids), atomic, func(tx *sql.Tx, i int) (int64, error) {
+		return ids[i], deleteProduct(ctx, tx, ids[i])
+	})
+}
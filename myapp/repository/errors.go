@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by every ProductRepository implementation. They are always
+// wrapped, so callers must compare them with errors.Is.
+var (
+	ErrNotFound    = errors.New("product not found")
+	ErrConflict    = errors.New("product conflict")
+	ErrValidation  = errors.New("invalid product")
+	ErrUnavailable = errors.New("repository unavailable")
+	// ErrVersionConflict means a conditional update expected a version the
+	// product no longer has.
+	ErrVersionConflict = errors.New("product version conflict")
+)
+
+// classifyPgError wraps err with the repository error matching its cause.
+// Errors that cannot be classified are returned unchanged.
+func classifyPgError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Name() == "unique_violation", pqErr.Code.Name() == "exclusion_violation":
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case pqErr.Code.Class() == "22", pqErr.Code.Class() == "23":
+			// data exceptions and the remaining integrity constraint violations
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57":
+			// connection exceptions, insufficient resources and operator intervention
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// contextError reports a canceled or expired context as ErrUnavailable, the
+// same way a query aborted by its context is classified.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassifyPgError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, ErrConflict},
+		{"not null violation", &pq.Error{Code: "23502"}, ErrValidation},
+		{"numeric out of range", &pq.Error{Code: "22003"}, ErrValidation},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, ErrUnavailable},
+		{"bad connection", driver.ErrBadConn, ErrUnavailable},
+		{"deadline", context.DeadlineExceeded, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		got := classifyPgError(fmt.Errorf("query failed: %w", tt.err))
+		if !errors.Is(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+		if !errors.Is(got, tt.err) {
+			t.Errorf("%s: original error was not kept in %v", tt.name, got)
+		}
+	}
+}
+
+func TestClassifyPgError_Unknown(t *testing.T) {
+	err := &pq.Error{Code: "42601"}
+
+	got := classifyPgError(err)
+	for _, sentinel := range []error{ErrNotFound, ErrConflict, ErrValidation, ErrUnavailable} {
+		if errors.Is(got, sentinel) {
+			t.Errorf("expected %v to stay unclassified, got %v", err, sentinel)
+		}
+	}
+}
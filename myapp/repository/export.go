@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// EXPORT
+func (r *PostgresProductRepository) ExportProducts(ctx context.Context, filter ProductFilter, sort []SortField, fn func(models.Product) error) error {
+	// no QueryTimeout: an export lasts as long as the client takes to read
+	// it, and the export handler bounds ctx instead
+	var args queryArgs
+	query := `SELECT ` + productColumns + ` FROM products` + where(filterConditions(filter, &args)) + orderByClause(sort)
+
+	// lib/pq reads the rows off the connection as they are scanned, so only
+	// one product is held at a time
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not export products: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Product
+		if err := scanProduct(rows, &p); err != nil {
+			return fmt.Errorf("could not read product: %w", classifyPgError(err))
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not export products: %w", classifyPgError(err))
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/lib/pq"
+)
+
+// Outcomes of an imported product.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+)
+
+var (
+	// ErrDuplicateImport means a SKU or a name, or the product it matches,
+	// was already imported earlier in the same import.
+	ErrDuplicateImport = errors.New("product already imported")
+	// ErrAmbiguousName means several live products have the name of an
+	// imported product without a SKU, so it is not known which one to update.
+	ErrAmbiguousName = errors.New("name shared by several products")
+)
+
+// ImportResult is the outcome of one imported product. ID is zero for a
+// product that a dry run would create. For an ErrDuplicateImport, ID is the
+// product that was already imported, if there is one.
+type ImportResult struct {
+	Action string
+	ID     int64
+	Err    error
+}
+
+// planImport decides what importing each product does, given the live
+// products it matches by SKU, or by name when it has no SKU, and returns the
+// indexes of the products to insert and to update.
+func planImport(products []models.Product, matches map[int][]models.Product) (results []ImportResult, creates, updates []int) {
+	results = make([]ImportResult, len(products))
+	seenSKUs, seenNames := make(map[string]bool), make(map[string]bool)
+	seenIDs := make(map[int64]bool)
+	for i, p := range products {
+		m := matches[i]
+		switch {
+		case p.SKU != "" && seenSKUs[p.SKU]:
+			results[i].Err = fmt.Errorf("SKU %q: %w", p.SKU, ErrDuplicateImport)
+		case p.SKU == "" && seenNames[p.Name]:
+			results[i].Err = fmt.Errorf("%q: %w", p.Name, ErrDuplicateImport)
+		case len(m) > 1:
+			results[i].Err = fmt.Errorf("%q: %w", p.Name, ErrAmbiguousName)
+		case len(m) == 0:
+			results[i].Action = ImportCreated
+			creates = append(creates, i)
+		case seenIDs[m[0].ID]:
+			// a product is written at most once, whether it is matched by its
+			// SKU or by its name
+			results[i] = ImportResult{ID: m[0].ID, Err: fmt.Errorf("product %d: %w", m[0].ID, ErrDuplicateImport)}
+		case m[0].Name == p.Name && m[0].Price == p.Price:
+			results[i] = ImportResult{Action: ImportUnchanged, ID: m[0].ID}
+		default:
+			results[i] = ImportResult{Action: ImportUpdated, ID: m[0].ID}
+			updates = append(updates, i)
+		}
+		if p.SKU != "" {
+			seenSKUs[p.SKU] = true
+		} else {
+			seenNames[p.Name] = true
+		}
+		if len(m) == 1 {
+			seenIDs[m[0].ID] = true
+		}
+	}
+	return results, creates, updates
+}
+
+// qualifiedColumns is productColumns prefixed with a table alias.
+func qualifiedColumns(alias string) string {
+	columns := strings.Split(productColumns, ", ")
+	for i := range columns {
+		columns[i] = alias + "." + columns[i]
+	}
+	return strings.Join(columns, ", ")
+}
+
+// copyRows writes n rows into table with COPY, which is much faster than an
+// INSERT per row.
+func copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, n int, row func(i int) []interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return fmt.Errorf("could not copy into %s: %w", table, classifyPgError(err))
+	}
+	defer stmt.Close()
+
+	for i := 0; i < n; i++ {
+		if _, err := stmt.ExecContext(ctx, row(i)...); err != nil {
+			return fmt.Errorf("could not copy into %s: %w", table, classifyPgError(err))
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("could not copy into %s: %w", table, classifyPgError(err))
+	}
+	return nil
+}
+
+type productChange struct {
+	action        string
+	before, after *models.Product
+}
+
+// recordChanges is recordChange for many changes at once, written with COPY.
+func recordChanges(ctx context.Context, tx *sql.Tx, changes []productChange) error {
+	err := copyRows(ctx, tx, "product_audit", []string{"product_id", "action", "actor", "claimed_actor", "request_id", "before", "after"}, len(changes),
+		func(i int) []interface{} {
+			c := changes[i]
+			entry := newAuditEntry(ctx, c.action, c.before, c.after)
+			return []interface{}{entry.ProductID, entry.Action, entry.Actor, entry.ClaimedActor, entry.RequestID, snapshot(c.before), snapshot(c.after)}
+		})
+	if err != nil {
+		return err
+	}
+
+	var repriced []int64
+	var priced []*models.Product
+	for _, c := range changes {
+		if c.after == nil || (c.before != nil && c.before.Price == c.after.Price) {
+			continue
+		}
+		priced = append(priced, c.after)
+		if c.before != nil {
+			repriced = append(repriced, c.after.ID)
+		}
+	}
+
+	if len(repriced) > 0 {
+		// changes made in one transaction share its now()
+		_, err := tx.ExecContext(ctx, `UPDATE product_prices SET valid_to = now() WHERE product_id = ANY($1) AND valid_to IS NULL`, pq.Array(repriced))
+		if err != nil {
+			return fmt.Errorf("could not close prices: %w", classifyPgError(err))
+		}
+	}
+	return copyRows(ctx, tx, "product_prices", []string{"product_id", "price", "currency", "valid_from"}, len(priced),
+		func(i int) []interface{} {
+			p := priced[i]
+			return []interface{}{p.ID, p.Price.Amount, p.Price.Currency, p.UpdatedAt}
+		})
+}
+
+// stageImport copies the products into a temporary table dropped with tx.
+func stageImport(ctx context.Context, tx *sql.Tx, products []models.Product) error {
+	_, err := tx.ExecContext(ctx, `CREATE TEMP TABLE import_products (
+		idx      INTEGER        NOT NULL,
+		sku      TEXT           NOT NULL,
+		name     TEXT           NOT NULL,
+		price    NUMERIC(19, 4) NOT NULL,
+		currency TEXT           NOT NULL
+	) ON COMMIT DROP`)
+	if err != nil {
+		return fmt.Errorf("could not stage import: %w", classifyPgError(err))
+	}
+
+	return copyRows(ctx, tx, "import_products", []string{"idx", "sku", "name", "price", "currency"}, len(products),
+		func(i int) []interface{} {
+			p := products[i]
+			return []interface{}{i, p.SKU, p.Name, p.Price.Amount, p.Price.Currency}
+		})
+}
+
+// lockImportMatches locks the live products with the SKU of a staged
+// product, or its name when it has no SKU, and returns them by the index of
+// that product.
+func lockImportMatches(ctx context.Context, tx *sql.Tx) (map[int][]models.Product, error) {
+	query := `SELECT ` + qualifiedColumns("p") + `, i.idx
+		FROM import_products i JOIN products p
+			ON (i.sku <> '' AND p.sku = i.sku) OR (i.sku = '' AND p.name = i.name)
+		WHERE p.deleted_at IS NULL
+		ORDER BY p.id FOR UPDATE OF p`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not match imported products: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	matches := make(map[int][]models.Product)
+	for rows.Next() {
+		var p models.Product
+		var idx int
+		if err := scanProduct(rows, &p, &idx); err != nil {
+			return nil, fmt.Errorf("could not read product: %w", classifyPgError(err))
+		}
+		matches[idx] = append(matches[idx], p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not match imported products: %w", classifyPgError(err))
+	}
+	return matches, nil
+}
+
+// writeImport runs a query writing the staged products at the given indexes
+// and returns the written products.
+func writeImport(ctx context.Context, tx *sql.Tx, query string, indexes []int, args ...interface{}) ([]models.Product, error) {
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	written := make([]models.Product, 0, len(indexes))
+	rows, err := tx.QueryContext(ctx, query, append([]interface{}{pq.Array(indexes)}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not import products: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Product
+		if err := scanProduct(rows, &p); err != nil {
+			return nil, fmt.Errorf("could not read product: %w", classifyPgError(err))
+		}
+		written = append(written, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not import products: %w", classifyPgError(err))
+	}
+	return written, nil
+}
+
+// IMPORT
+func (r *PostgresProductRepository) ImportProducts(ctx context.Context, products []models.Product, dryRun bool) ([]ImportResult, error) {
+	// no QueryTimeout: writing up to MaxImportRows products takes longer than
+	// any single query, and the import handler bounds ctx instead
+	var results []ImportResult
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := stageImport(ctx, tx, products); err != nil {
+			return err
+		}
+		matches, err := lockImportMatches(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		var creates, updates []int
+		results, creates, updates = planImport(products, matches)
+		if dryRun {
+			return nil
+		}
+
+		// a new product is told apart by its SKU and name, which planImport
+		// keeps unique among the products inserted
+		created, err := writeImport(ctx, tx, `INSERT INTO products (sku, name, price, currency)
+			SELECT NULLIF(sku, ''), name, price, currency FROM import_products WHERE idx = ANY($1) ORDER BY idx
+			RETURNING `+productColumns, creates)
+		if err != nil {
+			return err
+		}
+		ids := make([]int64, len(updates))
+		for j, i := range updates {
+			ids[j] = matches[i][0].ID
+		}
+		updated, err := writeImport(ctx, tx, `UPDATE products p
+			SET name = i.name, price = i.price, currency = i.currency, version = p.version + 1, updated_at = now()
+			FROM unnest($1::integer[], $2::bigint[]) AS u(idx, id) JOIN import_products i ON i.idx = u.idx
+			WHERE p.id = u.id
+			RETURNING `+qualifiedColumns("p"), updates, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		type naturalKey struct{ sku, name string }
+		createdByKey := make(map[naturalKey]models.Product, len(created))
+		for _, p := range created {
+			createdByKey[naturalKey{p.SKU, p.Name}] = p
+		}
+		updatedByID := make(map[int64]models.Product, len(updated))
+		for _, p := range updated {
+			updatedByID[p.ID] = p
+		}
+
+		var changes []productChange
+		for _, i := range creates {
+			after := createdByKey[naturalKey{products[i].SKU, products[i].Name}]
+			results[i].ID = after.ID
+			changes = append(changes, productChange{action: audit.ActionCreate, after: &after})
+		}
+		for _, i := range updates {
+			before := matches[i][0]
+			after := updatedByID[before.ID]
+			changes = append(changes, productChange{action: audit.ActionUpdate, before: &before, after: &after})
+		}
+		return recordChanges(ctx, tx, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
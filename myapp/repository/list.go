@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+)
+
+// ListOptions selects one page of products.
+type ListOptions struct {
+	// Limit caps the number of products returned. Zero means no limit.
+	Limit  int
+	Offset int
+	// After, when set, starts the page right after the product it points to.
+	// It must come from a page listed with the same Sort.
+	After  *Cursor
+	Filter ProductFilter
+	// Sort orders the products. Products are always ordered by ID last.
+	Sort []SortField
+}
+
+// ProductFilter keeps the products matching every condition that is set.
+type ProductFilter struct {
+	// NameContains matches names containing it, ignoring case.
+	NameContains string
+	// MinPrice and MaxPrice compare amounts alone, whatever their currency.
+	MinPrice *money.Amount
+	MaxPrice *money.Amount
+	// Currency matches products priced in it.
+	Currency string
+	IDs      []int64
+	// IncludeDeleted keeps deleted products, which are skipped otherwise.
+	IncludeDeleted bool
+}
+
+// Fields products can be sorted by.
+const (
+	SortByID    = "id"
+	SortByName  = "name"
+	SortByPrice = "price"
+)
+
+var sortColumns = map[string]string{
+	SortByID:    "id",
+	SortByName:  `name COLLATE "C"`,
+	SortByPrice: "price",
+}
+
+func IsSortable(field string) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// orderBy completes sort with the ID so the order is total, which keyset
+// pagination relies on.
+func orderBy(sort []SortField) []SortField {
+	for _, s := range sort {
+		if s.Field == SortByID {
+			return sort
+		}
+	}
+	return append(append([]SortField(nil), sort...), SortField{Field: SortByID})
+}
+
+// Cursor marks the position of a product in the list order, so the next page
+// can be fetched with a keyset condition instead of an offset.
+type Cursor struct {
+	ID    int64        `json:"id"`
+	Name  string       `json:"name,omitempty"`
+	Price money.Amount `json:"price,omitempty"`
+}
+
+// CursorFor records the values of p that the sort fields may refer to.
+func CursorFor(p models.Product) Cursor {
+	return Cursor{ID: p.ID, Name: p.Name, Price: p.Price.Amount}
+}
+
+func (c Cursor) value(field string) interface{} {
+	switch field {
+	case SortByName:
+		return c.Name
+	case SortByPrice:
+		return c.Price
+	default:
+		return c.ID
+	}
+}
+
+// compareProducts orders a and b the way Postgres does for sort, with
+// names compared byte by byte like the "C" collation.
+func compareProducts(a, b Cursor, sort []SortField) int {
+	for _, s := range orderBy(sort) {
+		var c int
+		switch s.Field {
+		case SortByName:
+			c = strings.Compare(a.Name, b.Name)
+		case SortByPrice:
+			c = compareNumbers(a.Price, b.Price)
+		default:
+			c = compareNumbers(a.ID, b.ID)
+		}
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareNumbers[T ~int64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (f ProductFilter) matches(p models.Product) bool {
+	if p.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	if f.MinPrice != nil && p.Price.Amount < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && p.Price.Amount > *f.MaxPrice {
+		return false
+	}
+	if f.Currency != "" && p.Price.Currency != f.Currency {
+		return false
+	}
+	if len(f.IDs) > 0 {
+		for _, id := range f.IDs {
+			if id == p.ID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type ProductPage struct {
+	Products []models.Product
+	// Total counts every product matching the filter, not only those in the page.
+	Total int64
+	// Next points to the last product of the page when more products follow.
+	Next *Cursor
+}
+
+// newPage trims the limit+1 products fetched by an implementation to the
+// requested limit, recording whether a next page exists.
+func newPage(products []models.Product, total int64, opts ListOptions) ProductPage {
+	page := ProductPage{Products: products, Total: total}
+	if page.Products == nil {
+		page.Products = []models.Product{}
+	}
+
+	if opts.Limit > 0 && len(page.Products) > opts.Limit {
+		page.Products = page.Products[:opts.Limit]
+		next := CursorFor(page.Products[opts.Limit-1])
+		page.Next = &next
+	}
+	return page
+}
@@ -0,0 +1,618 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// MemoryProductRepository keeps products in memory. It behaves like
+// PostgresProductRepository and is meant for local development and tests.
+type MemoryProductRepository struct {
+	mu       sync.RWMutex
+	products map[int64]models.Product
+	lastID   int64
+	history  []models.AuditEntry
+	prices   map[int64][]models.PricePeriod
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{
+		products: make(map[int64]models.Product),
+		prices:   make(map[int64][]models.PricePeriod),
+	}
+}
+
+// record appends a change to the history and the price history. r.mu must
+// be held for writing, so they are updated atomically with the change.
+func (r *MemoryProductRepository) record(ctx context.Context, action string, before, after *models.Product) {
+	entry := newAuditEntry(ctx, action, before, after)
+	entry.ID = int64(len(r.history)) + 1
+	entry.ChangedAt = now()
+	if after != nil {
+		// like Postgres, everything changed together shares one timestamp
+		entry.ChangedAt = after.UpdatedAt
+	}
+	r.history = append(r.history, entry)
+
+	switch {
+	case after == nil:
+		delete(r.prices, entry.ProductID)
+	case before == nil || before.Price != after.Price:
+		prices := r.prices[after.ID]
+		if n := len(prices); n > 0 {
+			validTo := after.UpdatedAt
+			prices[n-1].ValidTo = &validTo
+		}
+		r.prices[after.ID] = append(prices, models.PricePeriod{Price: after.Price, ValidFrom: after.UpdatedAt})
+	}
+}
+
+// now returns the current time with the microsecond precision of a Postgres
+// timestamp.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// POST
+func (r *MemoryProductRepository) InsertProduct(ctx context.Context, p models.Product) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, fmt.Errorf("could not insert product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.insert(ctx, p)
+}
+
+// skuTaken tells whether a live product other than id has the SKU, which
+// products_sku_key forbids in Postgres. r.mu must be held.
+func (r *MemoryProductRepository) skuTaken(sku string, id int64) bool {
+	if sku == "" {
+		return false
+	}
+	for _, p := range r.products {
+		if p.SKU == sku && p.ID != id && p.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds p. r.mu must be held for writing.
+func (r *MemoryProductRepository) insert(ctx context.Context, p models.Product) (int64, error) {
+	if r.skuTaken(p.SKU, 0) {
+		return 0, fmt.Errorf("could not insert product: SKU %q is taken: %w", p.SKU, ErrConflict)
+	}
+	// like a Postgres sequence, an ID is never handed out twice
+	r.lastID++
+	p.ID = r.lastID
+	p.Version = 1
+	p.CreatedAt = now()
+	p.UpdatedAt = p.CreatedAt
+	p.DeletedAt = nil
+	r.products[p.ID] = p
+	r.record(ctx, audit.ActionCreate, nil, &p)
+
+	return p.ID, nil
+}
+
+// GET
+func (r *MemoryProductRepository) GetProductByID(ctx context.Context, id int64) (models.Product, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.products[id]
+	if !ok || p.DeletedAt != nil {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+
+	return p, nil
+}
+
+// DELETE
+func (r *MemoryProductRepository) DeleteProductByID(ctx context.Context, id int64) error {
+	if err := contextError(ctx); err != nil {
+		return fmt.Errorf("could not delete product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.delete(ctx, id)
+}
+
+// delete soft deletes a product. r.mu must be held for writing.
+func (r *MemoryProductRepository) delete(ctx context.Context, id int64) error {
+	p, ok := r.products[id]
+	if !ok || p.DeletedAt != nil {
+		return fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	before := p
+	// the product is kept until PurgeDeletedProducts so it can be restored
+	deletedAt := now()
+	p.DeletedAt = &deletedAt
+	p.UpdatedAt = deletedAt
+	p.Version++
+	r.products[id] = p
+	r.record(ctx, audit.ActionDelete, &before, &p)
+
+	return nil
+}
+
+// PUT
+func (r *MemoryProductRepository) UpdateProductByID(ctx context.Context, id int64, p models.Product) error {
+	if err := contextError(ctx); err != nil {
+		return fmt.Errorf("could not update product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.update(ctx, id, p)
+	return err
+}
+
+// update replaces a product. r.mu must be held for writing.
+func (r *MemoryProductRepository) update(ctx context.Context, id int64, p models.Product) (models.Product, error) {
+	current, ok := r.products[id]
+	if !ok || current.DeletedAt != nil {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	if p.Version != 0 && p.Version != current.Version {
+		return models.Product{}, fmt.Errorf("product %d is no longer at version %d: %w", id, p.Version, ErrVersionConflict)
+	}
+	if r.skuTaken(p.SKU, id) {
+		return models.Product{}, fmt.Errorf("could not update product: SKU %q is taken: %w", p.SKU, ErrConflict)
+	}
+	p.ID = id
+	p.Version = current.Version + 1
+	p.CreatedAt = current.CreatedAt
+	p.UpdatedAt = now()
+	p.DeletedAt = nil
+	r.products[id] = p
+	r.record(ctx, audit.ActionUpdate, &current, &p)
+
+	return p, nil
+}
+
+// GET BY SKU
+func (r *MemoryProductRepository) GetProductBySKU(ctx context.Context, sku string) (models.Product, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, ok := r.findSKU(sku); ok {
+		return p, nil
+	}
+	return models.Product{}, fmt.Errorf("no product found with SKU %q: %w", sku, ErrNotFound)
+}
+
+// findSKU returns the live product with the SKU. r.mu must be held.
+func (r *MemoryProductRepository) findSKU(sku string) (models.Product, bool) {
+	for _, p := range r.products {
+		if p.SKU == sku && p.DeletedAt == nil {
+			return p, true
+		}
+	}
+	return models.Product{}, false
+}
+
+// PUT BY SKU
+func (r *MemoryProductRepository) UpsertProductBySKU(ctx context.Context, sku string, p models.Product) (models.Product, bool, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, false, fmt.Errorf("could not upsert product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.SKU = sku
+	current, ok := r.findSKU(sku)
+	switch {
+	case !ok && p.Version != 0:
+		return models.Product{}, false, fmt.Errorf("no product found with SKU %q at version %d: %w", sku, p.Version, ErrVersionConflict)
+	case !ok:
+		id, err := r.insert(ctx, p)
+		if err != nil {
+			return models.Product{}, false, err
+		}
+		return r.products[id], true, nil
+	}
+	after, err := r.update(ctx, current.ID, p)
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	return after, false, nil
+}
+
+// PATCH
+func (r *MemoryProductRepository) PatchProductByID(ctx context.Context, id int64, changes ProductChanges) (models.Product, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, fmt.Errorf("could not patch product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.products[id]
+	if !ok || p.DeletedAt != nil {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	if changes.Version != 0 && changes.Version != p.Version {
+		return models.Product{}, fmt.Errorf("product %d is no longer at version %d: %w", id, changes.Version, ErrVersionConflict)
+	}
+	if changes.IsEmpty() {
+		return p, nil
+	}
+	before := p
+	if changes.SKU != nil {
+		if r.skuTaken(*changes.SKU, id) {
+			return models.Product{}, fmt.Errorf("could not patch product: SKU %q is taken: %w", *changes.SKU, ErrConflict)
+		}
+		p.SKU = *changes.SKU
+	}
+	if changes.Name != nil {
+		p.Name = *changes.Name
+	}
+	if changes.Price != nil {
+		p.Price = *changes.Price
+	}
+	p.Version++
+	p.UpdatedAt = now()
+	r.products[id] = p
+	r.record(ctx, audit.ActionUpdate, &before, &p)
+
+	return p, nil
+}
+
+// GET ALL
+func (r *MemoryProductRepository) ListProducts(ctx context.Context, opts ListOptions) (ProductPage, error) {
+	if err := contextError(ctx); err != nil {
+		return ProductPage{}, fmt.Errorf("could not list products: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sp []models.Product
+	var total int64
+	for _, p := range r.products {
+		if !opts.Filter.matches(p) {
+			continue
+		}
+		total++
+		if opts.After != nil && compareProducts(CursorFor(p), *opts.After, opts.Sort) <= 0 {
+			continue
+		}
+		sp = append(sp, p)
+	}
+	sort.Slice(sp, func(i, j int) bool {
+		return compareProducts(CursorFor(sp[i]), CursorFor(sp[j]), opts.Sort) < 0
+	})
+
+	if opts.Offset >= len(sp) {
+		sp = nil
+	} else {
+		sp = sp[opts.Offset:]
+	}
+	if opts.Limit > 0 && len(sp) > opts.Limit+1 {
+		sp = sp[:opts.Limit+1]
+	}
+
+	return newPage(sp, total, opts), nil
+}
+
+// EXPORT
+func (r *MemoryProductRepository) ExportProducts(ctx context.Context, filter ProductFilter, sortFields []SortField, fn func(models.Product) error) error {
+	if err := contextError(ctx); err != nil {
+		return fmt.Errorf("could not export products: %w", err)
+	}
+
+	// the products are copied so fn runs without holding the lock
+	r.mu.RLock()
+	var sp []models.Product
+	for _, p := range r.products {
+		if filter.matches(p) {
+			sp = append(sp, p)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(sp, func(i, j int) bool {
+		return compareProducts(CursorFor(sp[i]), CursorFor(sp[j]), sortFields) < 0
+	})
+	for _, p := range sp {
+		if err := contextError(ctx); err != nil {
+			return fmt.Errorf("could not export products: %w", err)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SEARCH
+func (r *MemoryProductRepository) SearchProducts(ctx context.Context, q SearchQuery) ([]models.SearchResult, error) {
+	terms := SearchTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search has no words: %w", ErrValidation)
+	}
+	if err := contextError(ctx); err != nil {
+		return nil, fmt.Errorf("could not search products: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []models.SearchResult{}
+	for _, p := range r.products {
+		if p.DeletedAt != nil {
+			continue
+		}
+		if res, ok := matchName(p.Name, terms); ok {
+			res.Product = p
+			results = append(results, res)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Product.ID < results[j].Product.ID
+	})
+
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// RESTORE
+func (r *MemoryProductRepository) RestoreProductByID(ctx context.Context, id int64) (models.Product, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, fmt.Errorf("could not restore product: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.products[id]
+	if !ok {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	if p.DeletedAt == nil {
+		return p, nil
+	}
+	if r.skuTaken(p.SKU, id) {
+		return models.Product{}, fmt.Errorf("could not restore product: SKU %q is taken: %w", p.SKU, ErrConflict)
+	}
+	before := p
+	p.DeletedAt = nil
+	p.UpdatedAt = now()
+	p.Version++
+	r.products[id] = p
+	r.record(ctx, audit.ActionRestore, &before, &p)
+
+	return p, nil
+}
+
+// PURGE
+func (r *MemoryProductRepository) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, fmt.Errorf("could not purge products: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, p := range r.products {
+		if p.DeletedAt != nil && p.DeletedAt.Before(deletedBefore) {
+			removed := p
+			delete(r.products, id)
+			r.record(ctx, audit.ActionPurge, &removed, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// HISTORY
+func (r *MemoryProductRepository) ListProductHistory(ctx context.Context, id int64, opts HistoryOptions) (HistoryPage, error) {
+	if err := contextError(ctx); err != nil {
+		return HistoryPage{}, fmt.Errorf("could not list product history: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	for i := len(r.history) - 1; i >= 0; i-- {
+		e := r.history[i]
+		if e.ProductID != id || (opts.After != 0 && e.ID >= opts.After) {
+			continue
+		}
+		entries = append(entries, e)
+		if opts.Limit > 0 && len(entries) > opts.Limit {
+			break
+		}
+	}
+
+	return newHistoryPage(entries, opts), nil
+}
+
+// PRICES
+func (r *MemoryProductRepository) ListProductPrices(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, fmt.Errorf("could not list product prices: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, ok := r.products[id]; !ok || p.DeletedAt != nil {
+		return nil, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	return append([]models.PricePeriod(nil), r.prices[id]...), nil
+}
+
+// AS OF
+func (r *MemoryProductRepository) GetProductAsOf(ctx context.Context, id int64, at time.Time) (models.Product, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if e := r.history[i]; e.ProductID == id && !e.ChangedAt.After(at) {
+			return productAsOf(id, at, &e, nil, nil)
+		}
+	}
+	for _, e := range r.history {
+		if e.ProductID == id {
+			return productAsOf(id, at, nil, &e, nil)
+		}
+	}
+	return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+}
+
+// memoryState is a copy of the products and their history, taken so that a
+// failed atomic batch can be undone.
+type memoryState struct {
+	products map[int64]models.Product
+	history  int
+	prices   map[int64][]models.PricePeriod
+}
+
+// save copies the state. r.mu must be held. Like a Postgres sequence, lastID
+// is not part of it, so IDs taken by an undone batch are not reused.
+func (r *MemoryProductRepository) save() memoryState {
+	s := memoryState{
+		products: make(map[int64]models.Product, len(r.products)),
+		history:  len(r.history),
+		prices:   make(map[int64][]models.PricePeriod, len(r.prices)),
+	}
+	for id, p := range r.products {
+		s.products[id] = p
+	}
+	for id, prices := range r.prices {
+		s.prices[id] = append([]models.PricePeriod(nil), prices...)
+	}
+	return s
+}
+
+func (r *MemoryProductRepository) restore(s memoryState) {
+	r.products = s.products
+	r.history = r.history[:s.history]
+	r.prices = s.prices
+}
+
+// batch runs fn for each of n items while holding r.mu, undoing the whole
+// batch when an item of an atomic batch fails.
+func (r *MemoryProductRepository) batch(ctx context.Context, n int, atomic bool, fn func(i int) (int64, error)) ([]BatchResult, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, fmt.Errorf("could not apply batch: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var saved memoryState
+	if atomic {
+		saved = r.save()
+	}
+	results := make([]BatchResult, n)
+	for i := range results {
+		id, err := fn(i)
+		if err != nil && atomic {
+			r.restore(saved)
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		results[i] = BatchResult{ID: id, Err: err}
+	}
+	return results, nil
+}
+
+// BATCH POST
+func (r *MemoryProductRepository) InsertProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return r.batch(ctx, len(products), atomic, func(i int) (int64, error) {
+		return r.insert(ctx, products[i])
+	})
+}
+
+// BATCH PUT
+func (r *MemoryProductRepository) UpdateProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return r.batch(ctx, len(products), atomic, func(i int) (int64, error) {
+		_, err := r.update(ctx, products[i].ID, products[i])
+		return products[i].ID, err
+	})
+}
+
+// BATCH DELETE
+func (r *MemoryProductRepository) DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]BatchResult, error) {
+	return r.batch(ctx, len(ids), atomic, func(i int) (int64, error) {
+		return ids[i], r.delete(ctx, ids[i])
+	})
+}
+
+// IMPORT
+func (r *MemoryProductRepository) ImportProducts(ctx context.Context, products []models.Product, dryRun bool) ([]ImportResult, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, fmt.Errorf("could not import products: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := make(map[string][]models.Product)
+	for _, p := range r.products {
+		if p.DeletedAt == nil {
+			byName[p.Name] = append(byName[p.Name], p)
+		}
+	}
+	matches := make(map[int][]models.Product)
+	for i, p := range products {
+		if p.SKU != "" {
+			if m, ok := r.findSKU(p.SKU); ok {
+				matches[i] = []models.Product{m}
+			}
+		} else if m := byName[p.Name]; len(m) > 0 {
+			matches[i] = m
+		}
+	}
+
+	results, creates, updates := planImport(products, matches)
+	if dryRun {
+		return results, nil
+	}
+	for _, i := range creates {
+		// the SKU of a new product, if any, matched no live product and is
+		// imported once, so the insert cannot fail
+		results[i].ID, _ = r.insert(ctx, products[i])
+	}
+	for _, i := range updates {
+		p := matches[i][0]
+		p.Name, p.Price = products[i].Name, products[i].Price
+		if _, err := r.update(ctx, p.ID, p); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,14 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository/repositorytest"
+)
+
+func TestMemoryProductRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.ProductRepository {
+		return repository.NewMemoryProductRepository()
+	})
+}
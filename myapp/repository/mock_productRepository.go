@@ -1,31 +1,106 @@
 package repository
 
-import "github.com/bda-mota/MyFirstCRUD/myapp/models"
+import (
+	"context"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
 
 type MockManualProductRepository struct {
-	InsertProductFunc     func(p models.Product) (int64, error)
-	GetProductByIDFunc    func(id int64) (models.Product, error)
-	DeleteProductByIDFunc func(id int64) error
-	UpdateProductByIDFunc func(id int64, p models.Product) error
-	GetAllProductsFunc    func() (sp []models.Product, err error)
+	InsertProductFunc        func(ctx context.Context, p models.Product) (int64, error)
+	GetProductByIDFunc       func(ctx context.Context, id int64) (models.Product, error)
+	DeleteProductByIDFunc    func(ctx context.Context, id int64) error
+	UpdateProductByIDFunc    func(ctx context.Context, id int64, p models.Product) error
+	GetProductBySKUFunc      func(ctx context.Context, sku string) (models.Product, error)
+	UpsertProductBySKUFunc   func(ctx context.Context, sku string, p models.Product) (models.Product, bool, error)
+	PatchProductByIDFunc     func(ctx context.Context, id int64, changes ProductChanges) (models.Product, error)
+	ListProductsFunc         func(ctx context.Context, opts ListOptions) (ProductPage, error)
+	ExportProductsFunc       func(ctx context.Context, filter ProductFilter, sort []SortField, fn func(models.Product) error) error
+	SearchProductsFunc       func(ctx context.Context, q SearchQuery) ([]models.SearchResult, error)
+	RestoreProductByIDFunc   func(ctx context.Context, id int64) (models.Product, error)
+	PurgeDeletedProductsFunc func(ctx context.Context, deletedBefore time.Time) (int64, error)
+	ListProductHistoryFunc   func(ctx context.Context, id int64, opts HistoryOptions) (HistoryPage, error)
+	ListProductPricesFunc    func(ctx context.Context, id int64) ([]models.PricePeriod, error)
+	GetProductAsOfFunc       func(ctx context.Context, id int64, at time.Time) (models.Product, error)
+	InsertProductsFunc       func(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error)
+	UpdateProductsFunc       func(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error)
+	DeleteProductsFunc       func(ctx context.Context, ids []int64, atomic bool) ([]BatchResult, error)
+	ImportProductsFunc       func(ctx context.Context, products []models.Product, dryRun bool) ([]ImportResult, error)
+}
+
+func (m *MockManualProductRepository) InsertProduct(ctx context.Context, p models.Product) (int64, error) {
+	return m.InsertProductFunc(ctx, p)
+}
+
+func (m *MockManualProductRepository) GetProductByID(ctx context.Context, id int64) (models.Product, error) {
+	return m.GetProductByIDFunc(ctx, id)
+}
+
+func (m *MockManualProductRepository) DeleteProductByID(ctx context.Context, id int64) error {
+	return m.DeleteProductByIDFunc(ctx, id)
+}
+
+func (m *MockManualProductRepository) UpdateProductByID(ctx context.Context, id int64, p models.Product) error {
+	return m.UpdateProductByIDFunc(ctx, id, p)
+}
+
+func (m *MockManualProductRepository) GetProductBySKU(ctx context.Context, sku string) (models.Product, error) {
+	return m.GetProductBySKUFunc(ctx, sku)
+}
+
+func (m *MockManualProductRepository) UpsertProductBySKU(ctx context.Context, sku string, p models.Product) (models.Product, bool, error) {
+	return m.UpsertProductBySKUFunc(ctx, sku, p)
+}
+
+func (m *MockManualProductRepository) PatchProductByID(ctx context.Context, id int64, changes ProductChanges) (models.Product, error) {
+	return m.PatchProductByIDFunc(ctx, id, changes)
+}
+
+func (m *MockManualProductRepository) ListProducts(ctx context.Context, opts ListOptions) (ProductPage, error) {
+	return m.ListProductsFunc(ctx, opts)
+}
+
+func (m *MockManualProductRepository) ExportProducts(ctx context.Context, filter ProductFilter, sort []SortField, fn func(models.Product) error) error {
+	return m.ExportProductsFunc(ctx, filter, sort, fn)
+}
+
+func (m *MockManualProductRepository) SearchProducts(ctx context.Context, q SearchQuery) ([]models.SearchResult, error) {
+	return m.SearchProductsFunc(ctx, q)
+}
+
+func (m *MockManualProductRepository) RestoreProductByID(ctx context.Context, id int64) (models.Product, error) {
+	return m.RestoreProductByIDFunc(ctx, id)
+}
+
+func (m *MockManualProductRepository) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return m.PurgeDeletedProductsFunc(ctx, deletedBefore)
+}
+
+func (m *MockManualProductRepository) ListProductHistory(ctx context.Context, id int64, opts HistoryOptions) (HistoryPage, error) {
+	return m.ListProductHistoryFunc(ctx, id, opts)
+}
+
+func (m *MockManualProductRepository) ListProductPrices(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+	return m.ListProductPricesFunc(ctx, id)
 }
 
-func (m *MockManualProductRepository) InsertProduct(p models.Product) (int64, error) {
-	return m.InsertProductFunc(p)
+func (m *MockManualProductRepository) GetProductAsOf(ctx context.Context, id int64, at time.Time) (models.Product, error) {
+	return m.GetProductAsOfFunc(ctx, id, at)
 }
 
-func (m *MockManualProductRepository) GetProductByID(id int64) (models.Product, error) {
-	return m.GetProductByIDFunc(id)
+func (m *MockManualProductRepository) InsertProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return m.InsertProductsFunc(ctx, products, atomic)
 }
 
-func (m *MockManualProductRepository) DeleteProductByID(id int64) error {
-	return m.DeleteProductByIDFunc(id)
+func (m *MockManualProductRepository) UpdateProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error) {
+	return m.UpdateProductsFunc(ctx, products, atomic)
 }
 
-func (m *MockManualProductRepository) UpdateProductByID(id int64, p models.Product) error {
-	return m.UpdateProductByIDFunc(id, p)
+func (m *MockManualProductRepository) DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]BatchResult, error) {
+	return m.DeleteProductsFunc(ctx, ids, atomic)
 }
 
-func (m *MockManualProductRepository) GetAllProducts() (sp []models.Product, err error) {
-	return m.GetAllProductsFunc()
+func (m *MockManualProductRepository) ImportProducts(ctx context.Context, products []models.Product, dryRun bool) ([]ImportResult, error) {
+	return m.ImportProductsFunc(ctx, products, dryRun)
 }
@@ -0,0 +1,18 @@
+package repository
+
+import "github.com/bda-mota/MyFirstCRUD/myapp/money"
+
+// ProductChanges lists the product fields to change. Nil fields are kept.
+type ProductChanges struct {
+	// SKU is removed when set to "".
+	SKU   *string
+	Name  *string
+	Price *money.Money
+	// Version, when not zero, is the version the product must still have for
+	// the changes to apply.
+	Version int64
+}
+
+func (c ProductChanges) IsEmpty() bool {
+	return c.SKU == nil && c.Name == nil && c.Price == nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// productAsOf rebuilds product id as it was at the given instant from latest,
+// its last audit entry at or before that instant. Products older than the
+// audit log are rebuilt from the state recorded before their first entry, or
+// from current when they have no entry at all.
+func productAsOf(id int64, at time.Time, latest, first *models.AuditEntry, current *models.Product) (models.Product, error) {
+	var p *models.Product
+	switch {
+	case latest != nil:
+		p = latest.After
+	case first != nil:
+		if first.Action != audit.ActionCreate {
+			p = first.Before
+		}
+	default:
+		p = current
+	}
+
+	if p == nil || p.CreatedAt.After(at) || (p.DeletedAt != nil && !p.DeletedAt.After(at)) {
+		return models.Product{}, fmt.Errorf("no product found with ID %d at %s: %w", id, at.Format(time.RFC3339), ErrNotFound)
+	}
+	return *p, nil
+}
+
+// recordPrice closes the current price of p and opens a period for its new
+// price, starting at the time of the change.
+func recordPrice(ctx context.Context, tx *sql.Tx, p models.Product) error {
+	_, err := tx.ExecContext(ctx, `UPDATE product_prices SET valid_to = $2 WHERE product_id = $1 AND valid_to IS NULL`, p.ID, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("could not close price: %w", classifyPgError(err))
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO product_prices (product_id, price, currency, valid_from) VALUES ($1, $2, $3, $4)`,
+		p.ID, p.Price.Amount, p.Price.Currency, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("could not record price: %w", classifyPgError(err))
+	}
+	return nil
+}
+
+// PRICES
+func (r *PostgresProductRepository) ListProductPrices(ctx context.Context, id int64) ([]models.PricePeriod, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT pp.price, pp.currency, pp.valid_from, pp.valid_to
+		FROM product_prices pp JOIN products p ON p.id = pp.product_id
+		WHERE pp.product_id = $1 AND p.deleted_at IS NULL
+		ORDER BY pp.valid_from, pp.id`
+	rows, err := r.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not list product prices: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	var prices []models.PricePeriod
+	for rows.Next() {
+		var period models.PricePeriod
+
+		if err = rows.Scan(&period.Price.Amount, &period.Price.Currency, &period.ValidFrom, &period.ValidTo); err != nil {
+			return nil, fmt.Errorf("could not read product price: %w", classifyPgError(err))
+		}
+		period.ValidFrom = period.ValidFrom.UTC()
+		if period.ValidTo != nil {
+			validTo := period.ValidTo.UTC()
+			period.ValidTo = &validTo
+		}
+
+		prices = append(prices, period)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list product prices: %w", classifyPgError(err))
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	}
+	return prices, nil
+}
+
+// AS OF
+func (r *PostgresProductRepository) GetProductAsOf(ctx context.Context, id int64, at time.Time) (models.Product, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	entry := func(query string, args ...interface{}) (*models.AuditEntry, error) {
+		var e models.AuditEntry
+		var before, after []byte
+		err := r.DB.QueryRowContext(ctx, query, args...).Scan(&e.Action, &before, &after)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read product history: %w", classifyPgError(err))
+		}
+		if before != nil {
+			if err := json.Unmarshal(before, &e.Before); err != nil {
+				return nil, fmt.Errorf("could not read product history: %w", err)
+			}
+		}
+		if after != nil {
+			if err := json.Unmarshal(after, &e.After); err != nil {
+				return nil, fmt.Errorf("could not read product history: %w", err)
+			}
+		}
+		return &e, nil
+	}
+
+	latest, err := entry(`SELECT action, before, after FROM product_audit
+		WHERE product_id = $1 AND changed_at <= $2 ORDER BY id DESC LIMIT 1`, id, at)
+	if err != nil {
+		return models.Product{}, err
+	}
+	if latest != nil {
+		return productAsOf(id, at, latest, nil, nil)
+	}
+
+	first, err := entry(`SELECT action, before, after FROM product_audit
+		WHERE product_id = $1 ORDER BY id LIMIT 1`, id)
+	if err != nil {
+		return models.Product{}, err
+	}
+	if first != nil {
+		return productAsOf(id, at, nil, first, nil)
+	}
+
+	// a product created before the audit log, and never changed since
+	var current models.Product
+	err = scanProduct(r.DB.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE id = $1`, id), &current)
+	if err == sql.ErrNoRows {
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
+	} else if err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", classifyPgError(err))
+	}
+	return productAsOf(id, at, nil, nil, &current)
+}
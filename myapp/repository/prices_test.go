@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+)
+
+func TestProductAsOf(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	deletedAt := day(20)
+	legacy := &models.Product{ID: 1, Name: "Legacy", Price: money.MustParse("5", "USD"), CreatedAt: day(1)}
+	current := &models.Product{ID: 1, Name: "Current", Price: money.MustParse("7", "USD"), CreatedAt: day(1), DeletedAt: &deletedAt}
+	update := &models.AuditEntry{Action: audit.ActionUpdate, Before: legacy, After: current}
+	create := &models.AuditEntry{Action: audit.ActionCreate, After: current}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		latest  *models.AuditEntry
+		first   *models.AuditEntry
+		current *models.Product
+		want    string
+	}{
+		{"LatestEntry", day(15), update, nil, nil, "Current"},
+		{"DeletedAtThatTime", day(20), update, nil, nil, ""},
+		{"BeforeFirstUpdate", day(5), nil, update, nil, "Legacy"},
+		{"BeforeCreation", day(5), nil, create, nil, ""},
+		{"NeverAudited", day(5), nil, nil, legacy, "Legacy"},
+		{"NeverAuditedNotYetCreated", day(1).Add(-time.Second), nil, nil, legacy, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := productAsOf(1, tt.at, tt.latest, tt.first, tt.current)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got %v and %v", p, err)
+				}
+				return
+			}
+			if err != nil || p.Name != tt.want {
+				t.Errorf("expected %s, got %v and %v", tt.want, p, err)
+			}
+		})
+	}
+}
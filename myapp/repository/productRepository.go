@@ -1,106 +1,470 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
 	"github.com/bda-mota/MyFirstCRUD/myapp/models"
 )
 
 type ProductRepository interface {
-	InsertProduct(p models.Product) (int64, error)
-	GetProductByID(id int64) (models.Product, error)
-	DeleteProductByID(id int64) error
-	UpdateProductByID(id int64, p models.Product) error
-	GetAllProducts() (sp []models.Product, err error)
+	InsertProduct(ctx context.Context, p models.Product) (int64, error)
+	GetProductByID(ctx context.Context, id int64) (models.Product, error)
+	DeleteProductByID(ctx context.Context, id int64) error
+	UpdateProductByID(ctx context.Context, id int64, p models.Product) error
+	// GetProductBySKU returns the live product with the given SKU.
+	GetProductBySKU(ctx context.Context, sku string) (models.Product, error)
+	// UpsertProductBySKU replaces the live product with the given SKU, or
+	// inserts p when there is none, and reports whether it was inserted. A
+	// product with a version is only replaced if it is still at that version,
+	// and is never inserted.
+	UpsertProductBySKU(ctx context.Context, sku string, p models.Product) (models.Product, bool, error)
+	PatchProductByID(ctx context.Context, id int64, changes ProductChanges) (models.Product, error)
+	ListProducts(ctx context.Context, opts ListOptions) (ProductPage, error)
+	// ExportProducts calls fn with every product matching filter, in sort
+	// order, without loading them all at once. It stops at the first error
+	// of fn and returns it.
+	ExportProducts(ctx context.Context, filter ProductFilter, sort []SortField, fn func(models.Product) error) error
+	SearchProducts(ctx context.Context, q SearchQuery) ([]models.SearchResult, error)
+	// RestoreProductByID undeletes a product. Restoring a product that is not
+	// deleted returns it unchanged.
+	RestoreProductByID(ctx context.Context, id int64) (models.Product, error)
+	// PurgeDeletedProducts removes for good the products deleted before
+	// deletedBefore and returns how many were removed.
+	PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// ListProductHistory returns the audit entries of a product, newest first.
+	ListProductHistory(ctx context.Context, id int64, opts HistoryOptions) (HistoryPage, error)
+	// ListProductPrices returns the prices of a product, oldest first.
+	ListProductPrices(ctx context.Context, id int64) ([]models.PricePeriod, error)
+	// GetProductAsOf returns a product as it was at the given instant.
+	GetProductAsOf(ctx context.Context, id int64, at time.Time) (models.Product, error)
+	// InsertProducts, UpdateProducts and DeleteProducts apply a batch in
+	// order and return one result per item. An atomic batch is all or
+	// nothing: it stops at the first failing item and returns a *BatchError.
+	// Otherwise every item is tried and its failure only reported in its
+	// result. UpdateProducts finds products by their ID, and a product with a
+	// version is updated only if it is still at that version.
+	InsertProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error)
+	UpdateProducts(ctx context.Context, products []models.Product, atomic bool) ([]BatchResult, error)
+	DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]BatchResult, error)
+	// ImportProducts upserts products in one transaction. Like
+	// UpsertProductBySKU, a product with a SKU replaces the name and price of
+	// the live product with that SKU, or is inserted when there is none. A
+	// product without a SKU replaces the price of the live product with the
+	// same name instead. A product whose name is shared by several products,
+	// or whose SKU, name or matched product was imported earlier in the batch,
+	// is skipped, with an error in its result. A dry run returns the same
+	// results but writes nothing.
+	ImportProducts(ctx context.Context, products []models.Product, dryRun bool) ([]ImportResult, error)
 }
 type PostgresProductRepository struct {
 	DB *sql.DB
+	// QueryTimeout bounds every query on top of the caller's context.
+	// Zero means no extra deadline.
+	QueryTimeout time.Duration
+}
+
+// productColumns are the columns read by scanProduct, in order.
+const productColumns = `id, sku, name, price, currency, version, created_at, updated_at, deleted_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct reads productColumns into p, followed by any extra columns.
+// Timestamps are returned in UTC whatever the session time zone is.
+func scanProduct(row rowScanner, p *models.Product, extra ...interface{}) error {
+	var sku sql.NullString
+	dest := []interface{}{&p.ID, &sku, &p.Name, &p.Price.Amount, &p.Price.Currency, &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	p.SKU = sku.String
+	p.CreatedAt, p.UpdatedAt = p.CreatedAt.UTC(), p.UpdatedAt.UTC()
+	if p.DeletedAt != nil {
+		deletedAt := p.DeletedAt.UTC()
+		p.DeletedAt = &deletedAt
+	}
+	return nil
+}
+
+func (r *PostgresProductRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.QueryTimeout)
 }
 
 // POST
-func (r *PostgresProductRepository) InsertProduct(p models.Product) (int64, error) {
-	sql := `INSERT INTO products (name, price) VALUES ($1, $2) RETURNING id`
+func (r *PostgresProductRepository) InsertProduct(ctx context.Context, p models.Product) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
-	var id int64
-	if err := r.DB.QueryRow(sql, p.Name, p.Price).Scan(&id); err != nil {
-		return 0, fmt.Errorf("could not insert product: %v", err)
+	var created models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) (err error) {
+		created, err = insertProduct(ctx, tx, p)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return id, nil
+	return created.ID, nil
+}
+
+// insertProduct adds p. A SKU already used by a live product is a
+// unique_violation, reported as ErrConflict.
+func insertProduct(ctx context.Context, tx *sql.Tx, p models.Product) (models.Product, error) {
+	var created models.Product
+	sql := `INSERT INTO products (sku, name, price, currency) VALUES (NULLIF($1, ''), $2, $3, $4) RETURNING ` + productColumns
+	if err := scanProduct(tx.QueryRowContext(ctx, sql, p.SKU, p.Name, p.Price.Amount, p.Price.Currency), &created); err != nil {
+		return models.Product{}, fmt.Errorf("could not insert product: %w", classifyPgError(err))
+	}
+	if err := recordChange(ctx, tx, audit.ActionCreate, nil, &created); err != nil {
+		return models.Product{}, err
+	}
+	return created, nil
 }
 
 // GET
-func (r *PostgresProductRepository) GetProductByID(id int64) (models.Product, error) {
+func (r *PostgresProductRepository) GetProductByID(ctx context.Context, id int64) (models.Product, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var getProduct models.Product
-	row := `SELECT id, name, price FROM products WHERE id = $1`
-	err := r.DB.QueryRow(row, id).Scan(&getProduct.ID, &getProduct.Name, &getProduct.Price)
+	row := `SELECT ` + productColumns + ` FROM products WHERE id = $1 AND deleted_at IS NULL`
+	err := scanProduct(r.DB.QueryRowContext(ctx, row, id), &getProduct)
 
 	if err == sql.ErrNoRows {
-		return models.Product{}, nil
+		return models.Product{}, fmt.Errorf("no product found with ID %d: %w", id, ErrNotFound)
 	} else if err != nil {
-		return models.Product{}, fmt.Errorf("could not retrieve product: %v", err)
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", classifyPgError(err))
 	}
 
 	return getProduct, nil
 }
 
 // DELETE
-func (r *PostgresProductRepository) DeleteProductByID(id int64) error {
-	sql := `DELETE FROM products WHERE id = $1`
-	res, err := r.DB.Exec(sql, id)
-	if err != nil {
-		return fmt.Errorf("could not delete product: %v", err)
-	}
+func (r *PostgresProductRepository) DeleteProductByID(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return deleteProduct(ctx, tx, id)
+	})
+}
 
-	rowsAffected, err := res.RowsAffected()
+func deleteProduct(ctx context.Context, tx *sql.Tx, id int64) error {
+	before, err := lockProduct(ctx, tx, id, false)
 	if err != nil {
-		return fmt.Errorf("could not get rowws affected %v", err)
+		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no product found with ID %d", id)
+
+	// the row is kept until PurgeDeletedProducts so it can be restored
+	sql := `UPDATE products SET deleted_at = now(), updated_at = now(), version = version + 1
+		WHERE id = $1 RETURNING ` + productColumns
+	var after models.Product
+	if err := scanProduct(tx.QueryRowContext(ctx, sql, id), &after); err != nil {
+		return fmt.Errorf("could not delete product: %w", classifyPgError(err))
 	}
-	return nil
+	return recordChange(ctx, tx, audit.ActionDelete, &before, &after)
 }
 
 // PUT
-func (r *PostgresProductRepository) UpdateProductByID(id int64, p models.Product) error {
-	sql := `UPDATE products SET name = $1, price = $2 WHERE id = $3`
-	res, err := r.DB.Exec(sql, p.Name, p.Price, id)
+func (r *PostgresProductRepository) UpdateProductByID(ctx context.Context, id int64, p models.Product) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := updateProduct(ctx, tx, id, p)
+		return err
+	})
+}
+
+func updateProduct(ctx context.Context, tx *sql.Tx, id int64, p models.Product) (models.Product, error) {
+	before, err := lockProduct(ctx, tx, id, false)
 	if err != nil {
-		return fmt.Errorf("could not update product: %v", err)
+		return models.Product{}, err
+	}
+	if p.Version != 0 && p.Version != before.Version {
+		return models.Product{}, fmt.Errorf("product %d is no longer at version %d: %w", id, p.Version, ErrVersionConflict)
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	sql := `UPDATE products SET sku = NULLIF($1, ''), name = $2, price = $3, currency = $4, version = version + 1, updated_at = now()
+		WHERE id = $5 RETURNING ` + productColumns
+	var after models.Product
+	if err := scanProduct(tx.QueryRowContext(ctx, sql, p.SKU, p.Name, p.Price.Amount, p.Price.Currency, id), &after); err != nil {
+		return models.Product{}, fmt.Errorf("could not update product: %w", classifyPgError(err))
+	}
+	if err := recordChange(ctx, tx, audit.ActionUpdate, &before, &after); err != nil {
+		return models.Product{}, err
+	}
+	return after, nil
+}
+
+// GET BY SKU
+func (r *PostgresProductRepository) GetProductBySKU(ctx context.Context, sku string) (models.Product, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var p models.Product
+	query := `SELECT ` + productColumns + ` FROM products WHERE sku = $1 AND deleted_at IS NULL`
+	err := scanProduct(r.DB.QueryRowContext(ctx, query, sku), &p)
+
+	if err == sql.ErrNoRows {
+		return models.Product{}, fmt.Errorf("no product found with SKU %q: %w", sku, ErrNotFound)
+	} else if err != nil {
+		return models.Product{}, fmt.Errorf("could not retrieve product: %w", classifyPgError(err))
+	}
+
+	return p, nil
+}
+
+// PUT BY SKU
+func (r *PostgresProductRepository) UpsertProductBySKU(ctx context.Context, sku string, p models.Product) (models.Product, bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	p.SKU = sku
+	var after models.Product
+	var created bool
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// the lock keeps the product from being deleted or renamed before it
+		// is replaced; two concurrent inserts of a new SKU are told apart by
+		// products_sku_key, and the second one is a conflict
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM products WHERE sku = $1 AND deleted_at IS NULL FOR UPDATE`, sku).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows && p.Version != 0:
+			return fmt.Errorf("no product found with SKU %q at version %d: %w", sku, p.Version, ErrVersionConflict)
+		case err == sql.ErrNoRows:
+			created = true
+			after, err = insertProduct(ctx, tx, p)
+			return err
+		case err != nil:
+			return fmt.Errorf("could not retrieve product: %w", classifyPgError(err))
+		}
+		after, err = updateProduct(ctx, tx, id, p)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error checking affected rows: %v", err)
+		return models.Product{}, false, err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("product not found")
+
+	return after, created, nil
+}
+
+// PATCH
+func (r *PostgresProductRepository) PatchProductByID(ctx context.Context, id int64, changes ProductChanges) (models.Product, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var after models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockProduct(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if changes.Version != 0 && changes.Version != before.Version {
+			return fmt.Errorf("product %d is no longer at version %d: %w", id, changes.Version, ErrVersionConflict)
+		}
+		if changes.IsEmpty() {
+			after = before
+			return nil
+		}
+
+		var args queryArgs
+		var columns []string
+		if changes.SKU != nil {
+			columns = append(columns, `sku = NULLIF(`+args.add(*changes.SKU)+`, '')`)
+		}
+		if changes.Name != nil {
+			columns = append(columns, `name = `+args.add(*changes.Name))
+		}
+		if changes.Price != nil {
+			columns = append(columns, `price = `+args.add(changes.Price.Amount), `currency = `+args.add(changes.Price.Currency))
+		}
+		columns = append(columns, `version = version + 1`, `updated_at = now()`)
+		query := `UPDATE products SET ` + strings.Join(columns, ", ") +
+			` WHERE id = ` + args.add(id) + ` RETURNING ` + productColumns
+
+		if err := scanProduct(tx.QueryRowContext(ctx, query, args...), &after); err != nil {
+			return fmt.Errorf("could not patch product: %w", classifyPgError(err))
+		}
+		return recordChange(ctx, tx, audit.ActionUpdate, &before, &after)
+	})
+	if err != nil {
+		return models.Product{}, err
 	}
-	return nil
+
+	return after, nil
 }
 
 // GET ALL
-func (r *PostgresProductRepository) GetAllProducts() (sp []models.Product, err error) {
-	rows, err := r.DB.Query(`SELECT * FROM products`)
+func (r *PostgresProductRepository) ListProducts(ctx context.Context, opts ListOptions) (ProductPage, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var args queryArgs
+	conditions := filterConditions(opts.Filter, &args)
+
+	var total int64
+	count := `SELECT count(*) FROM products` + where(conditions)
+	if err := r.DB.QueryRowContext(ctx, count, args...).Scan(&total); err != nil {
+		return ProductPage{}, fmt.Errorf("could not count products: %w", classifyPgError(err))
+	}
+
+	if opts.After != nil {
+		conditions = append(conditions, keysetCondition(opts.Sort, *opts.After, &args))
+	}
+	query := `SELECT ` + productColumns + ` FROM products` + where(conditions) + orderByClause(opts.Sort)
+	if opts.Limit > 0 {
+		// one more row tells whether a next page exists
+		query += ` LIMIT ` + args.add(opts.Limit+1)
+	}
+	if opts.Offset > 0 {
+		query += ` OFFSET ` + args.add(opts.Offset)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return
+		return ProductPage{}, fmt.Errorf("could not list products: %w", classifyPgError(err))
 	}
 	defer rows.Close()
 
+	var sp []models.Product
 	for rows.Next() {
 		var p models.Product
 
-		if err = rows.Scan(&p.ID, &p.Name, &p.Price); err != nil {
-			continue
+		if err = scanProduct(rows, &p); err != nil {
+			return ProductPage{}, fmt.Errorf("could not read product: %w", classifyPgError(err))
 		}
 
 		sp = append(sp, p)
 	}
 
-	if len(sp) == 0 {
-		return nil, fmt.Errorf("no products found")
+	if err = rows.Err(); err != nil {
+		return ProductPage{}, fmt.Errorf("could not list products: %w", classifyPgError(err))
 	}
-	return sp, nil
+
+	return newPage(sp, total, opts), nil
+}
+
+// SEARCH
+func (r *PostgresProductRepository) SearchProducts(ctx context.Context, q SearchQuery) ([]models.SearchResult, error) {
+	terms := SearchTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search has no words: %w", ErrValidation)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var args queryArgs
+	tsquery := args.add(prefixQuery(terms))
+	headlineOptions := args.add(`StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=true`)
+	query := `SELECT ` + productColumns + `, ts_rank(search, q) AS rank, ts_headline('simple', name, q, ` + headlineOptions + `)
+		FROM products, to_tsquery('simple', ` + tsquery + `) AS q
+		WHERE search @@ q AND deleted_at IS NULL
+		ORDER BY rank DESC, id`
+	if q.Limit > 0 {
+		query += ` LIMIT ` + args.add(q.Limit)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not search products: %w", classifyPgError(err))
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+
+		if err = scanProduct(rows, &res.Product, &res.Rank, &res.Snippet); err != nil {
+			return nil, fmt.Errorf("could not read search result: %w", classifyPgError(err))
+		}
+		res.Snippet = highlight(res.Snippet)
+
+		results = append(results, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not search products: %w", classifyPgError(err))
+	}
+	return results, nil
+}
+
+// RESTORE
+func (r *PostgresProductRepository) RestoreProductByID(ctx context.Context, id int64) (models.Product, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var after models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockProduct(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			after = before
+			return nil
+		}
+
+		sql := `UPDATE products SET deleted_at = NULL, updated_at = now(), version = version + 1
+			WHERE id = $1 RETURNING ` + productColumns
+		if err := scanProduct(tx.QueryRowContext(ctx, sql, id), &after); err != nil {
+			return fmt.Errorf("could not restore product: %w", classifyPgError(err))
+		}
+		return recordChange(ctx, tx, audit.ActionRestore, &before, &after)
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	return after, nil
+}
+
+// PURGE
+func (r *PostgresProductRepository) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var purged int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `DELETE FROM products WHERE deleted_at < $1 RETURNING `+productColumns, deletedBefore)
+		if err != nil {
+			return fmt.Errorf("could not purge products: %w", classifyPgError(err))
+		}
+		defer rows.Close()
+
+		var removed []models.Product
+		for rows.Next() {
+			var p models.Product
+			if err := scanProduct(rows, &p); err != nil {
+				return fmt.Errorf("could not read purged product: %w", classifyPgError(err))
+			}
+			removed = append(removed, p)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("could not purge products: %w", classifyPgError(err))
+		}
+
+		for i := range removed {
+			if err := recordChange(ctx, tx, audit.ActionPurge, &removed[i], nil); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(removed))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
 }
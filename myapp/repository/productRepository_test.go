@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/migrations"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository/repositorytest"
+	_ "github.com/lib/pq"
+)
+
+// TestPostgresProductRepository runs the conformance suite against the
+// database in TEST_DATABASE_URL. Every table used by the suite is emptied.
+func TestPostgresProductRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repository.ProductRepository {
+		if _, err := db.Exec(`TRUNCATE products, product_audit, product_prices RESTART IDENTITY`); err != nil {
+			t.Fatalf("could not truncate products: %v", err)
+		}
+		return &repository.PostgresProductRepository{DB: db}
+	})
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// queryArgs collects the arguments of a query built at runtime.
+type queryArgs []interface{}
+
+// add appends v and returns its placeholder.
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func filterConditions(f ProductFilter, args *queryArgs) []string {
+	var conditions []string
+
+	if f.NameContains != "" {
+		pattern := "%" + likeEscaper.Replace(f.NameContains) + "%"
+		conditions = append(conditions, `name ILIKE `+args.add(pattern)+` ESCAPE '\'`)
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, `price >= `+args.add(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, `price <= `+args.add(*f.MaxPrice))
+	}
+	if f.Currency != "" {
+		conditions = append(conditions, `currency = `+args.add(f.Currency))
+	}
+	if len(f.IDs) > 0 {
+		conditions = append(conditions, `id = ANY(`+args.add(pq.Array(f.IDs))+`)`)
+	}
+	if !f.IncludeDeleted {
+		conditions = append(conditions, `deleted_at IS NULL`)
+	}
+
+	return conditions
+}
+
+func orderByClause(sort []SortField) string {
+	var terms []string
+	for _, s := range orderBy(sort) {
+		term := sortColumns[s.Field]
+		if s.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// keysetCondition keeps the rows that come after c in the sort order:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys.
+func keysetCondition(sort []SortField, c Cursor, args *queryArgs) string {
+	fields := orderBy(sort)
+
+	var alternatives []string
+	for i, s := range fields {
+		var terms []string
+		for _, prev := range fields[:i] {
+			terms = append(terms, sortColumns[prev.Field]+" = "+args.add(c.value(prev.Field)))
+		}
+		op := " > "
+		if s.Desc {
+			op = " < "
+		}
+		terms = append(terms, sortColumns[s.Field]+op+args.add(c.value(s.Field)))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	var args queryArgs
+	sort := []SortField{{Field: SortByPrice}, {Field: SortByName, Desc: true}}
+
+	got := keysetCondition(sort, Cursor{ID: 7, Name: "b", Price: 20000}, &args)
+
+	expected := `((price > $1) OR (price = $2 AND name COLLATE "C" < $3) OR ` +
+		`(price = $4 AND name COLLATE "C" = $5 AND id > $6))`
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if fmt.Sprint(args) != "[2 2 b 2 b 7]" {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+func TestFilterConditions(t *testing.T) {
+	var args queryArgs
+	minPrice := money.Amount(15000)
+
+	got := filterConditions(ProductFilter{NameContains: "50%_off", MinPrice: &minPrice, IDs: []int64{1, 2}}, &args)
+
+	expected := `[name ILIKE $1 ESCAPE '\' price >= $2 id = ANY($3) deleted_at IS NULL]`
+	if fmt.Sprint(got) != expected {
+		t.Errorf("expected %s, got %v", expected, got)
+	}
+	if args[0] != `%50\%\_off%` {
+		t.Errorf("expected escaped pattern, got %v", args[0])
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	if got := orderByClause(nil); got != " ORDER BY id" {
+		t.Errorf("unexpected default order %q", got)
+	}
+	if got := orderByClause([]SortField{{Field: SortByID, Desc: true}}); got != " ORDER BY id DESC" {
+		t.Errorf("unexpected order %q", got)
+	}
+}
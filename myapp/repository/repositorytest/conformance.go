@@ -0,0 +1,1353 @@
+// Package repositorytest provides a conformance suite that every
+// repository.ProductRepository implementation must pass.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/audit"
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+	"github.com/bda-mota/MyFirstCRUD/myapp/money"
+	"github.com/bda-mota/MyFirstCRUD/myapp/repository"
+)
+
+// Factory returns an empty repository. It is called once per subtest and
+// may register cleanups on t.
+type Factory func(t *testing.T) repository.ProductRepository
+
+// Run exercises the behavior shared by all ProductRepository implementations.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.ProductRepository)
+	}{
+		{"InsertAndGet", testInsertAndGet},
+		{"InsertAllocatesIncreasingIDs", testInsertAllocatesIncreasingIDs},
+		{"ExactPrices", testExactPrices},
+		{"Update", testUpdate},
+		{"Patch", testPatch},
+		{"ConditionalUpdate", testConditionalUpdate},
+		{"UniqueSKU", testUniqueSKU},
+		{"UpsertBySKU", testUpsertBySKU},
+		{"Timestamps", testTimestamps},
+		{"Delete", testDelete},
+		{"SoftDelete", testSoftDelete},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"History", testHistory},
+		{"HistoryPages", testHistoryPages},
+		{"Prices", testPrices},
+		{"AsOf", testAsOf},
+		{"AtomicBatch", testAtomicBatch},
+		{"PartialBatch", testPartialBatch},
+		{"Import", testImport},
+		{"ImportBySKU", testImportBySKU},
+		{"ImportDryRun", testImportDryRun},
+		{"ListOrderedByID", testListOrderedByID},
+		{"ListEmpty", testListEmpty},
+		{"ListLimitAndOffset", testListLimitAndOffset},
+		{"ListCursor", testListCursor},
+		{"ListFilter", testListFilter},
+		{"Export", testExport},
+		{"ListSort", testListSort},
+		{"Search", testSearch},
+		{"NotFound", testNotFound},
+		{"ConcurrentInserts", testConcurrentInserts},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func mustInsert(t *testing.T, repo repository.ProductRepository, p models.Product) int64 {
+	t.Helper()
+
+	id, err := repo.InsertProduct(context.Background(), p)
+	if err != nil {
+		t.Fatalf("could not insert %v: %v", p, err)
+	}
+	return id
+}
+
+func usd(amount string) money.Money {
+	return money.MustParse(amount, "USD")
+}
+
+// withoutTimestamps clears the times set by the repository, which tests can
+// only check against a range.
+func withoutTimestamps(p models.Product) models.Product {
+	p.CreatedAt, p.UpdatedAt, p.DeletedAt = time.Time{}, time.Time{}, nil
+	return p
+}
+
+func testInsertAndGet(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Test Product", Price: usd("10.5")})
+	if id <= 0 {
+		t.Fatalf("expected a positive ID, got %d", id)
+	}
+
+	got, err := repo.GetProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected get error: %v", err)
+	}
+	expected := models.Product{ID: id, Name: "Test Product", Price: usd("10.5"), Version: 1}
+	if withoutTimestamps(got) != expected {
+		t.Errorf("expected product %v, got %v", expected, got)
+	}
+}
+
+func testInsertAllocatesIncreasingIDs(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	first := mustInsert(t, repo, models.Product{Name: "First", Price: usd("1")})
+	if err := repo.DeleteProductByID(ctx, first); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	second := mustInsert(t, repo, models.Product{Name: "Second", Price: usd("2")})
+	if second <= first {
+		t.Errorf("expected ID greater than %d after delete, got %d", first, second)
+	}
+}
+
+func testExactPrices(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	prices := []money.Money{
+		usd("0.1"),
+		usd("0.2"),
+		money.MustParse("1234567.891", "KWD"),
+		money.MustParse("1500", "JPY"),
+	}
+	for _, price := range prices {
+		id := mustInsert(t, repo, models.Product{Name: "Product", Price: price})
+		got, err := repo.GetProductByID(ctx, id)
+		if err != nil {
+			t.Fatalf("unexpected get error: %v", err)
+		}
+		if got.Price != price {
+			t.Errorf("expected price %v, got %v", price, got.Price)
+		}
+	}
+
+	page, err := repo.ListProducts(ctx, repository.ListOptions{Sort: []repository.SortField{{Field: repository.SortByPrice}}})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	var sum money.Amount
+	for _, p := range page.Products[:2] {
+		sum += p.Price.Amount
+	}
+	if sum.String() != "0.3" {
+		t.Errorf("expected the two cheapest prices to add up to 0.3, got %s", sum)
+	}
+}
+
+func testUpdate(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Old name", Price: usd("10")})
+
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "New name", Price: usd("20")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+
+	got, err := repo.GetProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected get error: %v", err)
+	}
+	expected := models.Product{ID: id, Name: "New name", Price: usd("20"), Version: 2}
+	if withoutTimestamps(got) != expected {
+		t.Errorf("expected product %v, got %v", expected, got)
+	}
+}
+
+func testPatch(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Old name", Price: usd("10")})
+
+	price := usd("15")
+	got, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price})
+	if err != nil {
+		t.Fatalf("unexpected patch error: %v", err)
+	}
+	expected := models.Product{ID: id, Name: "Old name", Price: usd("15"), Version: 2}
+	if withoutTimestamps(got) != expected {
+		t.Errorf("expected patched product %v, got %v", expected, got)
+	}
+
+	got, err = repo.PatchProductByID(ctx, id, repository.ProductChanges{})
+	if err != nil {
+		t.Fatalf("unexpected patch error without changes: %v", err)
+	}
+	if withoutTimestamps(got) != expected {
+		t.Errorf("expected unchanged product %v, got %v", expected, got)
+	}
+
+	if got, _ := repo.GetProductByID(ctx, id); withoutTimestamps(got) != expected {
+		t.Errorf("expected stored product %v, got %v", expected, got)
+	}
+
+	name := "New name"
+	if _, err := repo.PatchProductByID(ctx, id+1000, repository.ProductChanges{Name: &name}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound patching a missing product, got %v", err)
+	}
+}
+
+func testConditionalUpdate(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("10")})
+
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd("20"), Version: 1}); err != nil {
+		t.Fatalf("unexpected update error at the current version: %v", err)
+	}
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd("30"), Version: 1}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict updating a stale version, got %v", err)
+	}
+
+	price := usd("40")
+	if _, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price, Version: 1}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict patching a stale version, got %v", err)
+	}
+	got, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price, Version: 2})
+	if err != nil {
+		t.Fatalf("unexpected patch error at the current version: %v", err)
+	}
+	expected := models.Product{ID: id, Name: "Product", Price: usd("40"), Version: 3}
+	if withoutTimestamps(got) != expected {
+		t.Errorf("expected product %v, got %v", expected, got)
+	}
+
+	if err := repo.UpdateProductByID(ctx, id+1000, models.Product{Name: "x", Price: usd("1"), Version: 1}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a missing product, got %v", err)
+	}
+}
+
+func testUniqueSKU(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{SKU: "TEA-1", Name: "Tea", Price: usd("2")})
+	other := mustInsert(t, repo, models.Product{Name: "Coffee", Price: usd("3")})
+	mustInsert(t, repo, models.Product{Name: "Milk", Price: usd("1")})
+
+	got, err := repo.GetProductBySKU(ctx, "TEA-1")
+	if err != nil || got.ID != id || got.SKU != "TEA-1" {
+		t.Fatalf("expected product %d by its SKU, got %v and %v", id, got, err)
+	}
+	if _, err := repo.GetProductBySKU(ctx, "tea-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected SKUs to be case sensitive, got %v", err)
+	}
+
+	if _, err := repo.InsertProduct(ctx, models.Product{SKU: "TEA-1", Name: "Green tea", Price: usd("2")}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("expected ErrConflict inserting a taken SKU, got %v", err)
+	}
+	if err := repo.UpdateProductByID(ctx, other, models.Product{SKU: "TEA-1", Name: "Coffee", Price: usd("3")}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("expected ErrConflict updating to a taken SKU, got %v", err)
+	}
+	sku := "TEA-1"
+	if _, err := repo.PatchProductByID(ctx, other, repository.ProductChanges{SKU: &sku}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("expected ErrConflict patching to a taken SKU, got %v", err)
+	}
+
+	// a deleted product gives its SKU up until it is restored
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+	if _, err := repo.GetProductBySKU(ctx, "TEA-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the SKU of a deleted product, got %v", err)
+	}
+	patched, err := repo.PatchProductByID(ctx, other, repository.ProductChanges{SKU: &sku})
+	if err != nil || patched.SKU != "TEA-1" {
+		t.Fatalf("expected the SKU of the deleted product to be free, got %v and %v", patched, err)
+	}
+	if _, err := repo.RestoreProductByID(ctx, id); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("expected ErrConflict restoring a product whose SKU is taken, got %v", err)
+	}
+
+	empty := ""
+	if patched, err := repo.PatchProductByID(ctx, other, repository.ProductChanges{SKU: &empty}); err != nil || patched.SKU != "" {
+		t.Fatalf("expected the SKU to be removed, got %v and %v", patched, err)
+	}
+	if _, err := repo.RestoreProductByID(ctx, id); err != nil {
+		t.Errorf("unexpected restore error once the SKU is free: %v", err)
+	}
+}
+
+func testUpsertBySKU(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	created, inserted, err := repo.UpsertProductBySKU(ctx, "TEA-1", models.Product{Name: "Tea", Price: usd("2")})
+	if err != nil || !inserted {
+		t.Fatalf("expected the product to be inserted, got %v and %v", inserted, err)
+	}
+	expected := models.Product{ID: created.ID, SKU: "TEA-1", Name: "Tea", Price: usd("2"), Version: 1}
+	if withoutTimestamps(created) != expected {
+		t.Errorf("expected product %v, got %v", expected, created)
+	}
+
+	replaced, inserted, err := repo.UpsertProductBySKU(ctx, "TEA-1", models.Product{SKU: "OTHER", Name: "Green tea", Price: usd("3")})
+	if err != nil || inserted {
+		t.Fatalf("expected the product to be replaced, got %v and %v", inserted, err)
+	}
+	expected = models.Product{ID: created.ID, SKU: "TEA-1", Name: "Green tea", Price: usd("3"), Version: 2}
+	if withoutTimestamps(replaced) != expected {
+		t.Errorf("expected product %v, got %v", expected, replaced)
+	}
+	if got, _ := repo.GetProductByID(ctx, created.ID); withoutTimestamps(got) != expected {
+		t.Errorf("expected stored product %v, got %v", expected, got)
+	}
+
+	if _, _, err := repo.UpsertProductBySKU(ctx, "TEA-1", models.Product{Name: "Tea", Price: usd("4"), Version: 1}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict replacing a stale version, got %v", err)
+	}
+	if _, _, err := repo.UpsertProductBySKU(ctx, "NEW-1", models.Product{Name: "New", Price: usd("1"), Version: 1}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict upserting a version of a missing product, got %v", err)
+	}
+	if _, err := repo.GetProductBySKU(ctx, "NEW-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected nothing inserted for a version, got %v", err)
+	}
+
+	// after a delete, the SKU is inserted again as a new product
+	if err := repo.DeleteProductByID(ctx, created.ID); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+	again, inserted, err := repo.UpsertProductBySKU(ctx, "TEA-1", models.Product{Name: "Tea", Price: usd("2")})
+	if err != nil || !inserted || again.ID == created.ID {
+		t.Errorf("expected a new product for the SKU of a deleted one, got %v, %v and %v", again, inserted, err)
+	}
+}
+
+func testTimestamps(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Minute)
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("10")})
+	created, err := repo.GetProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected get error: %v", err)
+	}
+	if created.CreatedAt.Before(before) || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected fresh and equal timestamps, got created %v and updated %v", created.CreatedAt, created.UpdatedAt)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd("20")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	updated, err := repo.GetProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected get error: %v", err)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected creation time %v to be kept, got %v", created.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("expected update time after %v, got %v", created.UpdatedAt, updated.UpdatedAt)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	price := usd("30")
+	patched, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price})
+	if err != nil {
+		t.Fatalf("unexpected patch error: %v", err)
+	}
+	if !patched.UpdatedAt.After(updated.UpdatedAt) || !patched.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected patch to move only the update time, got %v", patched)
+	}
+}
+
+func testDelete(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Test Product", Price: usd("10")})
+	other := mustInsert(t, repo, models.Product{Name: "Other", Price: usd("10")})
+
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+	if _, err := repo.GetProductByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for deleted product, got %v", err)
+	}
+	if _, err := repo.GetProductByID(ctx, other); err != nil {
+		t.Errorf("expected other product to survive, got %v", err)
+	}
+}
+
+func testSoftDelete(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Deleted juice", Price: usd("10")})
+	other := mustInsert(t, repo, models.Product{Name: "Other juice", Price: usd("10")})
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	if err := repo.DeleteProductByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "x", Price: usd("1")}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted product, got %v", err)
+	}
+	price := usd("1")
+	if _, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound patching a deleted product, got %v", err)
+	}
+
+	page, err := repo.ListProducts(ctx, repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != 1 || page.Products[0].ID != other || page.Total != 1 {
+		t.Errorf("expected only product %d to be listed, got %v (total %d)", other, page.Products, page.Total)
+	}
+
+	page, err = repo.ListProducts(ctx, repository.ListOptions{Filter: repository.ProductFilter{IncludeDeleted: true}})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != 2 || page.Products[0].DeletedAt == nil || page.Products[1].DeletedAt != nil {
+		t.Errorf("expected the deleted product to be listed with its deletion time, got %v", page.Products)
+	}
+
+	results, err := repo.SearchProducts(ctx, repository.SearchQuery{Text: "juice"})
+	if err != nil {
+		t.Fatalf("unexpected search error: %v", err)
+	}
+	if len(results) != 1 || results[0].Product.ID != other {
+		t.Errorf("expected the search to skip the deleted product, got %v", results)
+	}
+}
+
+func testRestore(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("10")})
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	restored, err := repo.RestoreProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Version != 3 {
+		t.Errorf("expected an undeleted product at version 3, got %v", restored)
+	}
+	if _, err := repo.GetProductByID(ctx, id); err != nil {
+		t.Errorf("expected the restored product to be found, got %v", err)
+	}
+
+	again, err := repo.RestoreProductByID(ctx, id)
+	if err != nil || again.Version != restored.Version {
+		t.Errorf("expected restoring twice to change nothing, got %v and %v", again, err)
+	}
+
+	if _, err := repo.RestoreProductByID(ctx, id+1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a missing product, got %v", err)
+	}
+}
+
+func testPurge(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	deleted := mustInsert(t, repo, models.Product{Name: "Deleted", Price: usd("10")})
+	kept := mustInsert(t, repo, models.Product{Name: "Kept", Price: usd("10")})
+	if err := repo.DeleteProductByID(ctx, deleted); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	purged, err := repo.PurgeDeletedProducts(ctx, time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Errorf("expected nothing to purge within the retention period, got %d and %v", purged, err)
+	}
+
+	purged, err = repo.PurgeDeletedProducts(ctx, time.Now().Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Errorf("expected the deleted product to be purged, got %d and %v", purged, err)
+	}
+	if _, err := repo.RestoreProductByID(ctx, deleted); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected a purged product to be gone, got %v", err)
+	}
+	if _, err := repo.GetProductByID(ctx, kept); err != nil {
+		t.Errorf("expected the live product to survive, got %v", err)
+	}
+}
+
+func testHistory(t *testing.T, repo repository.ProductRepository) {
+	ctx := audit.WithInfo(context.Background(), audit.Info{Actor: "alice", ClaimedActor: "mallory", RequestID: "req-1"})
+
+	id, err := repo.InsertProduct(ctx, models.Product{Name: "Product", Price: usd("10")})
+	if err != nil {
+		t.Fatalf("unexpected insert error: %v", err)
+	}
+	other := mustInsert(t, repo, models.Product{Name: "Other", Price: usd("1")})
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd("12")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	price := usd("15")
+	if _, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price}); err != nil {
+		t.Fatalf("unexpected patch error: %v", err)
+	}
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+	if _, err := repo.RestoreProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+	// failed changes leave no trace
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd("20"), Version: 1}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	page, err := repo.ListProductHistory(ctx, id, repository.HistoryOptions{})
+	if err != nil {
+		t.Fatalf("unexpected history error: %v", err)
+	}
+	var actions []string
+	for _, e := range page.Entries {
+		actions = append(actions, e.Action)
+		if e.ProductID != id || e.Actor != "alice" || e.ClaimedActor != "mallory" || e.RequestID != "req-1" || e.ChangedAt.IsZero() {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+	if got, expected := fmt.Sprint(actions), "[restore delete update update create]"; got != expected {
+		t.Fatalf("expected actions %s, newest first, got %s", expected, got)
+	}
+
+	created, priced := page.Entries[4], page.Entries[2]
+	if created.Before != nil || created.After == nil || created.After.Price != usd("10") {
+		t.Errorf("expected the creation to record only the new product, got %+v", created)
+	}
+	if priced.Before == nil || priced.After == nil || priced.Before.Price != usd("12") || priced.After.Price != usd("15") {
+		t.Errorf("expected the patch to record the price change from 12 to 15, got %+v", priced)
+	}
+	if page.Entries[1].After.DeletedAt == nil {
+		t.Errorf("expected the deletion to record the deletion time, got %+v", page.Entries[1])
+	}
+
+	page, err = repo.ListProductHistory(context.Background(), other, repository.HistoryOptions{})
+	if err != nil {
+		t.Fatalf("unexpected history error: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Actor != audit.SystemActor {
+		t.Errorf("expected one entry by the system actor, got %+v", page.Entries)
+	}
+}
+
+func testHistoryPages(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("1")})
+	for i := 2; i <= 5; i++ {
+		if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Product", Price: usd(fmt.Sprint(i))}); err != nil {
+			t.Fatalf("unexpected update error: %v", err)
+		}
+	}
+
+	var prices []money.Amount
+	opts := repository.HistoryOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		page, err := repo.ListProductHistory(ctx, id, opts)
+		if err != nil {
+			t.Fatalf("unexpected history error: %v", err)
+		}
+		for _, e := range page.Entries {
+			prices = append(prices, e.After.Price.Amount)
+		}
+		if page.Next == 0 {
+			break
+		}
+		opts.After = page.Next
+	}
+
+	if got, expected := fmt.Sprint(prices), "[5 4 3 2 1]"; got != expected {
+		t.Errorf("expected prices %s across pages, got %s", expected, got)
+	}
+
+	page, err := repo.ListProductHistory(ctx, id+1000, repository.HistoryOptions{})
+	if err != nil || len(page.Entries) != 0 {
+		t.Errorf("expected an empty history for a missing product, got %v and %v", page.Entries, err)
+	}
+}
+
+func testPrices(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("10")})
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Renamed", Price: usd("10")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Renamed", Price: usd("12")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	price := usd("15")
+	patched, err := repo.PatchProductByID(ctx, id, repository.ProductChanges{Price: &price})
+	if err != nil {
+		t.Fatalf("unexpected patch error: %v", err)
+	}
+
+	prices, err := repo.ListProductPrices(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected prices error: %v", err)
+	}
+	if len(prices) != 3 || prices[0].Price != usd("10") || prices[1].Price != usd("12") || prices[2].Price != usd("15") {
+		t.Fatalf("expected prices 10, 12 and 15, got %v", prices)
+	}
+	for i := 0; i < 2; i++ {
+		if prices[i].ValidTo == nil || !prices[i].ValidTo.Equal(prices[i+1].ValidFrom) {
+			t.Errorf("expected price %d to end when price %d starts, got %v", i, i+1, prices)
+		}
+	}
+	if prices[2].ValidTo != nil || !prices[2].ValidFrom.Equal(patched.UpdatedAt) {
+		t.Errorf("expected the current price to start at the last update, got %v", prices[2])
+	}
+
+	if _, err := repo.ListProductPrices(ctx, id+1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing product, got %v", err)
+	}
+}
+
+func testAsOf(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("10")})
+	created, _ := repo.GetProductByID(ctx, id)
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "Renamed", Price: usd("12")}); err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	updated, _ := repo.GetProductByID(ctx, id)
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.DeleteProductByID(ctx, id); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected *models.Product
+	}{
+		{"BeforeCreation", created.CreatedAt.Add(-time.Second), nil},
+		{"AtCreation", created.CreatedAt, &created},
+		{"BeforeUpdate", updated.UpdatedAt.Add(-time.Microsecond), &created},
+		{"AtUpdate", updated.UpdatedAt, &updated},
+		{"AfterDelete", time.Now().Add(time.Second), nil},
+	}
+	for _, tt := range tests {
+		got, err := repo.GetProductAsOf(ctx, id, tt.at)
+		if tt.expected == nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				t.Errorf("%s: expected ErrNotFound, got %v and %v", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if withoutTimestamps(got) != withoutTimestamps(*tt.expected) || !got.UpdatedAt.Equal(tt.expected.UpdatedAt) {
+			t.Errorf("%s: expected %v, got %v", tt.name, *tt.expected, got)
+		}
+	}
+
+	if _, err := repo.GetProductAsOf(ctx, id+1000, time.Now()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing product, got %v", err)
+	}
+}
+
+func testListOrderedByID(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	var ids []int64
+	for _, name := range []string{"C", "A", "B"} {
+		ids = append(ids, mustInsert(t, repo, models.Product{Name: name, Price: usd("1")}))
+	}
+
+	page, err := repo.ListProducts(ctx, repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	list := page.Products
+	if len(list) != len(ids) {
+		t.Fatalf("expected %d products, got %d", len(ids), len(list))
+	}
+	for i, p := range list {
+		if p.ID != ids[i] {
+			t.Errorf("expected ID %d at position %d, got %d", ids[i], i, p.ID)
+		}
+	}
+}
+
+func testListEmpty(t *testing.T, repo repository.ProductRepository) {
+	page, err := repo.ListProducts(context.Background(), repository.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if page.Products == nil || len(page.Products) != 0 || page.Total != 0 || page.Next != nil {
+		t.Errorf("expected an empty, non-nil page, got %+v", page)
+	}
+}
+
+func testListLimitAndOffset(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, mustInsert(t, repo, models.Product{Name: fmt.Sprintf("Product %d", i), Price: usd("1")}))
+	}
+
+	page, err := repo.ListProducts(ctx, repository.ListOptions{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != 2 || page.Products[0].ID != ids[1] || page.Products[1].ID != ids[2] {
+		t.Errorf("expected products %v, got %v", ids[1:3], page.Products)
+	}
+	if page.Total != 5 {
+		t.Errorf("expected total 5, got %d", page.Total)
+	}
+	if page.Next == nil || page.Next.ID != ids[2] {
+		t.Errorf("expected next cursor at ID %d, got %+v", ids[2], page.Next)
+	}
+
+	page, err = repo.ListProducts(ctx, repository.ListOptions{Limit: 2, Offset: 3})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != 2 || page.Next != nil {
+		t.Errorf("expected a last page of 2 products, got %+v", page)
+	}
+
+	page, err = repo.ListProducts(ctx, repository.ListOptions{Limit: 2, Offset: 10})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != 0 || page.Total != 5 {
+		t.Errorf("expected an empty page past the end, got %+v", page)
+	}
+}
+
+func testListCursor(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, mustInsert(t, repo, models.Product{Name: fmt.Sprintf("Product %d", i), Price: usd("1")}))
+	}
+
+	var seen []int64
+	opts := repository.ListOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatalf("cursor pagination does not terminate")
+		}
+
+		page, err := repo.ListProducts(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected list error: %v", err)
+		}
+		for _, p := range page.Products {
+			seen = append(seen, p.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		// a product removed between two pages must not break the cursor
+		if pages == 0 {
+			if err := repo.DeleteProductByID(ctx, page.Next.ID); err != nil {
+				t.Fatalf("unexpected delete error: %v", err)
+			}
+		}
+		opts.After = page.Next
+	}
+
+	expected := fmt.Sprint(ids)
+	if got := fmt.Sprint(seen); got != expected {
+		t.Errorf("expected to walk through %s, got %s", expected, got)
+	}
+}
+
+func testAtomicBatch(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	results, err := repo.InsertProducts(ctx, []models.Product{
+		{Name: "First", Price: usd("1")},
+		{Name: "Second", Price: usd("2")},
+	}, true)
+	if err != nil {
+		t.Fatalf("unexpected insert error: %v", err)
+	}
+	if len(results) != 2 || results[0].ID == 0 || results[1].ID <= results[0].ID {
+		t.Fatalf("expected two new IDs in order, got %+v", results)
+	}
+	first, second := results[0].ID, results[1].ID
+
+	// the second item fails, so the update of the first is undone
+	_, err = repo.UpdateProducts(ctx, []models.Product{
+		{ID: first, Name: "First renamed", Price: usd("1")},
+		{ID: second + 1000, Name: "Missing", Price: usd("1")},
+	}, true)
+	var batchErr *repository.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a BatchError for item 1 wrapping ErrNotFound, got %v", err)
+	}
+	if got, _ := repo.GetProductByID(ctx, first); got.Name != "First" || got.Version != 1 {
+		t.Errorf("expected the failed batch to be undone, got %+v", got)
+	}
+	if page, _ := repo.ListProductHistory(ctx, first, repository.HistoryOptions{}); len(page.Entries) != 1 {
+		t.Errorf("expected only the creation in the history, got %+v", page.Entries)
+	}
+
+	_, err = repo.DeleteProducts(ctx, []int64{second, second}, true)
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected deleting twice to fail at item 1, got %v", err)
+	}
+	if _, err := repo.GetProductByID(ctx, second); err != nil {
+		t.Errorf("expected the product to survive the failed batch, got %v", err)
+	}
+
+	results, err = repo.DeleteProducts(ctx, []int64{first, second}, true)
+	if err != nil || len(results) != 2 || results[0].ID != first || results[1].ID != second {
+		t.Fatalf("unexpected delete results %+v (%v)", results, err)
+	}
+	page, _ := repo.ListProducts(ctx, repository.ListOptions{})
+	if len(page.Products) != 0 {
+		t.Errorf("expected every product to be deleted, got %v", page.Products)
+	}
+}
+
+func testPartialBatch(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("1")})
+	other := mustInsert(t, repo, models.Product{Name: "Other", Price: usd("1")})
+
+	results, err := repo.UpdateProducts(ctx, []models.Product{
+		{ID: id, Name: "Renamed", Price: usd("2")},
+		{ID: id + 1000, Name: "Missing", Price: usd("2")},
+		{ID: other, Name: "Stale", Price: usd("2"), Version: 7},
+		{ID: other, Name: "Other renamed", Price: usd("3"), Version: 1},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", results)
+	}
+	if results[0].Err != nil || results[3].Err != nil {
+		t.Errorf("expected items 0 and 3 to succeed, got %+v", results)
+	}
+	if !errors.Is(results[1].Err, repository.ErrNotFound) || results[1].ID != id+1000 {
+		t.Errorf("expected item 1 to be not found, got %+v", results[1])
+	}
+	if !errors.Is(results[2].Err, repository.ErrVersionConflict) {
+		t.Errorf("expected item 2 to be a version conflict, got %+v", results[2])
+	}
+
+	page, _ := repo.ListProducts(ctx, repository.ListOptions{})
+	if got := names(page.Products); got != "[Renamed Other renamed]" {
+		t.Errorf("expected the successful items to be kept, got %s", got)
+	}
+
+	results, err = repo.InsertProducts(ctx, []models.Product{{Name: "New", Price: usd("1")}}, false)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected insert results %+v (%v)", results, err)
+	}
+	if got, err := repo.GetProductByID(ctx, results[0].ID); err != nil || got.Name != "New" {
+		t.Errorf("expected the inserted product, got %+v (%v)", got, err)
+	}
+
+	results, err = repo.DeleteProducts(ctx, []int64{id, id}, false)
+	if err != nil || results[0].Err != nil || !errors.Is(results[1].Err, repository.ErrNotFound) {
+		t.Errorf("expected only the first delete to succeed, got %+v (%v)", results, err)
+	}
+}
+
+func testImport(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	kept := mustInsert(t, repo, models.Product{Name: "Kept", Price: usd("1")})
+	repriced := mustInsert(t, repo, models.Product{Name: "Repriced", Price: usd("1")})
+	mustInsert(t, repo, models.Product{Name: "Twin", Price: usd("1")})
+	mustInsert(t, repo, models.Product{Name: "Twin", Price: usd("2")})
+	deleted := mustInsert(t, repo, models.Product{Name: "Deleted", Price: usd("1")})
+	if err := repo.DeleteProductByID(ctx, deleted); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	results, err := repo.ImportProducts(ctx, []models.Product{
+		{Name: "Kept", Price: usd("1")},
+		{Name: "Repriced", Price: money.MustParse("2.50", "EUR")},
+		{Name: "New", Price: usd("3")},
+		{Name: "Twin", Price: usd("4")},
+		{Name: "New", Price: usd("5")},
+		{Name: "Deleted", Price: usd("6")},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %+v", results)
+	}
+	if results[0].Action != repository.ImportUnchanged || results[0].ID != kept {
+		t.Errorf("expected Kept to be unchanged, got %+v", results[0])
+	}
+	if results[1].Action != repository.ImportUpdated || results[1].ID != repriced {
+		t.Errorf("expected Repriced to be updated, got %+v", results[1])
+	}
+	if results[2].Action != repository.ImportCreated || results[2].ID == 0 {
+		t.Errorf("expected New to be created, got %+v", results[2])
+	}
+	if !errors.Is(results[3].Err, repository.ErrAmbiguousName) {
+		t.Errorf("expected Twin to be ambiguous, got %+v", results[3])
+	}
+	if !errors.Is(results[4].Err, repository.ErrDuplicateImport) {
+		t.Errorf("expected the second New to be a duplicate, got %+v", results[4])
+	}
+	if results[5].Action != repository.ImportCreated || results[5].ID == deleted {
+		t.Errorf("expected a deleted product to be imported as a new one, got %+v", results[5])
+	}
+
+	got, _ := repo.GetProductByID(ctx, repriced)
+	if got.Price != money.MustParse("2.5", "EUR") || got.Version != 2 {
+		t.Errorf("expected the new price at version 2, got %+v", got)
+	}
+	got, _ = repo.GetProductByID(ctx, results[2].ID)
+	if got.Name != "New" || got.Price != usd("3") {
+		t.Errorf("expected the first New to be imported, got %+v", got)
+	}
+	if got, _ := repo.GetProductByID(ctx, kept); got.Version != 1 {
+		t.Errorf("expected an unchanged product to keep its version, got %+v", got)
+	}
+
+	// imports are recorded like any other change
+	page, _ := repo.ListProductHistory(ctx, repriced, repository.HistoryOptions{})
+	if len(page.Entries) != 2 || page.Entries[0].Action != audit.ActionUpdate || page.Entries[0].Before.Price != usd("1") {
+		t.Errorf("expected the import to be recorded as an update, got %+v", page.Entries)
+	}
+	page, _ = repo.ListProductHistory(ctx, results[2].ID, repository.HistoryOptions{})
+	if len(page.Entries) != 1 || page.Entries[0].Action != audit.ActionCreate {
+		t.Errorf("expected the import to be recorded as a creation, got %+v", page.Entries)
+	}
+	prices, _ := repo.ListProductPrices(ctx, repriced)
+	if len(prices) != 2 || prices[0].ValidTo == nil || prices[1].Price != money.MustParse("2.5", "EUR") || prices[1].ValidTo != nil {
+		t.Errorf("expected the import to start a new price, got %v", prices)
+	}
+	prices, _ = repo.ListProductPrices(ctx, results[2].ID)
+	if len(prices) != 1 || prices[0].Price != usd("3") {
+		t.Errorf("expected the created product to have a price, got %v", prices)
+	}
+}
+
+func testImportBySKU(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	tea := mustInsert(t, repo, models.Product{SKU: "TEA-1", Name: "Tea", Price: usd("1")})
+	milk := mustInsert(t, repo, models.Product{SKU: "MILK-1", Name: "Milk", Price: usd("1")})
+	old := mustInsert(t, repo, models.Product{SKU: "OLD-1", Name: "Old", Price: usd("1")})
+	if err := repo.DeleteProductByID(ctx, old); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	results, err := repo.ImportProducts(ctx, []models.Product{
+		{SKU: "TEA-1", Name: "Green tea", Price: usd("2")},
+		{SKU: "NEW-1", Name: "Tea", Price: usd("3")},
+		{SKU: "TEA-1", Name: "Black tea", Price: usd("4")},
+		{Name: "Milk", Price: usd("5")},
+		{SKU: "MILK-1", Name: "Milk", Price: usd("6")},
+		{SKU: "OLD-1", Name: "Old", Price: usd("7")},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %+v", results)
+	}
+	if results[0].Action != repository.ImportUpdated || results[0].ID != tea {
+		t.Errorf("expected TEA-1 to be updated, got %+v", results[0])
+	}
+	if results[1].Action != repository.ImportCreated || results[1].ID == 0 {
+		t.Errorf("expected NEW-1 to be created rather than to match Tea by name, got %+v", results[1])
+	}
+	if !errors.Is(results[2].Err, repository.ErrDuplicateImport) {
+		t.Errorf("expected the second TEA-1 to be a duplicate, got %+v", results[2])
+	}
+	if results[3].Action != repository.ImportUpdated || results[3].ID != milk {
+		t.Errorf("expected Milk to be updated by name, got %+v", results[3])
+	}
+	if !errors.Is(results[4].Err, repository.ErrDuplicateImport) || results[4].ID != milk {
+		t.Errorf("expected MILK-1 to be a duplicate of the Milk already imported, got %+v", results[4])
+	}
+	if results[5].Action != repository.ImportCreated || results[5].ID == old {
+		t.Errorf("expected the SKU of a deleted product to be imported as a new one, got %+v", results[5])
+	}
+
+	// the import agrees with UpsertProductBySKU on the product of a SKU
+	got, err := repo.GetProductBySKU(ctx, "TEA-1")
+	if err != nil || got.ID != tea || got.Name != "Green tea" || got.Price != usd("2") || got.Version != 2 {
+		t.Errorf("expected TEA-1 to be renamed and repriced at version 2, got %+v (%v)", got, err)
+	}
+	if got, err := repo.GetProductBySKU(ctx, "NEW-1"); err != nil || got.ID != results[1].ID || got.Name != "Tea" {
+		t.Errorf("expected NEW-1 to be created with its SKU, got %+v (%v)", got, err)
+	}
+	if got, _ := repo.GetProductByID(ctx, milk); got.SKU != "MILK-1" || got.Price != usd("5") {
+		t.Errorf("expected an update by name to keep the SKU, got %+v", got)
+	}
+	if got, err := repo.GetProductBySKU(ctx, "OLD-1"); err != nil || got.ID != results[5].ID {
+		t.Errorf("expected OLD-1 to be the new product, got %+v (%v)", got, err)
+	}
+
+	page, _ := repo.ListProductHistory(ctx, tea, repository.HistoryOptions{})
+	if len(page.Entries) != 2 || page.Entries[0].Action != audit.ActionUpdate || page.Entries[0].Before.Name != "Tea" || page.Entries[0].After.Name != "Green tea" {
+		t.Errorf("expected the rename to be recorded, got %+v", page.Entries)
+	}
+}
+
+func testImportDryRun(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("1")})
+	results, err := repo.ImportProducts(ctx, []models.Product{
+		{Name: "Product", Price: usd("2")},
+		{Name: "New", Price: usd("3")},
+	}, true)
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != repository.ImportUpdated || results[0].ID != id ||
+		results[1].Action != repository.ImportCreated || results[1].ID != 0 {
+		t.Errorf("unexpected dry run results %+v", results)
+	}
+
+	page, _ := repo.ListProducts(ctx, repository.ListOptions{})
+	if len(page.Products) != 1 || page.Products[0].Price != usd("1") || page.Products[0].Version != 1 {
+		t.Errorf("expected a dry run to change nothing, got %+v", page.Products)
+	}
+	history, _ := repo.ListProductHistory(ctx, id, repository.HistoryOptions{})
+	if len(history.Entries) != 1 {
+		t.Errorf("expected a dry run to record nothing, got %+v", history.Entries)
+	}
+}
+
+func names(products []models.Product) string {
+	var names []string
+	for _, p := range products {
+		names = append(names, p.Name)
+	}
+	return fmt.Sprint(names)
+}
+
+func testListFilter(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	apple := mustInsert(t, repo, models.Product{Name: "Green Apple", Price: usd("2")})
+	mustInsert(t, repo, models.Product{Name: "Pineapple", Price: usd("5")})
+	mustInsert(t, repo, models.Product{Name: "Banana", Price: usd("1")})
+	mustInsert(t, repo, models.Product{Name: "100% Juice", Price: usd("3")})
+	melon := mustInsert(t, repo, models.Product{Name: "Melon", Price: money.MustParse("8", "EUR")})
+
+	minPrice, maxPrice := money.Amount(20000), money.Amount(50000)
+	tests := []struct {
+		name     string
+		filter   repository.ProductFilter
+		expected string
+	}{
+		{"name ignoring case", repository.ProductFilter{NameContains: "APPLE"}, "[Green Apple Pineapple]"},
+		{"name with wildcard characters", repository.ProductFilter{NameContains: "0%"}, "[100% Juice]"},
+		{"price range", repository.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}, "[Green Apple Pineapple 100% Juice]"},
+		{"currency", repository.ProductFilter{Currency: "EUR"}, "[Melon]"},
+		{"ids", repository.ProductFilter{IDs: []int64{melon, apple}}, "[Green Apple Melon]"},
+		{"combined", repository.ProductFilter{NameContains: "apple", MaxPrice: &minPrice}, "[Green Apple]"},
+	}
+
+	for _, tt := range tests {
+		page, err := repo.ListProducts(ctx, repository.ListOptions{Filter: tt.filter})
+		if err != nil {
+			t.Fatalf("%s: unexpected list error: %v", tt.name, err)
+		}
+		if got := names(page.Products); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+		if page.Total != int64(len(page.Products)) {
+			t.Errorf("%s: expected total %d, got %d", tt.name, len(page.Products), page.Total)
+		}
+	}
+}
+
+func testExport(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	for _, p := range []models.Product{
+		{Name: "Banana", Price: usd("2")},
+		{Name: "Apple", Price: usd("3")},
+		{Name: "Cherry", Price: usd("1")},
+		{Name: "Apricot", Price: usd("3")},
+	} {
+		mustInsert(t, repo, p)
+	}
+	deleted := mustInsert(t, repo, models.Product{Name: "Avocado", Price: usd("4")})
+	if err := repo.DeleteProductByID(ctx, deleted); err != nil {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+
+	var exported []models.Product
+	sort := []repository.SortField{{Field: repository.SortByPrice, Desc: true}, {Field: repository.SortByName}}
+	err := repo.ExportProducts(ctx, repository.ProductFilter{NameContains: "a"}, sort, func(p models.Product) error {
+		exported = append(exported, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+	if got := names(exported); got != "[Apple Apricot Banana]" {
+		t.Errorf("expected the live products containing a by price and name, got %s", got)
+	}
+
+	exported = nil
+	err = repo.ExportProducts(ctx, repository.ProductFilter{IncludeDeleted: true}, nil, func(p models.Product) error {
+		exported = append(exported, p)
+		return nil
+	})
+	if err != nil || names(exported) != "[Banana Apple Cherry Apricot Avocado]" {
+		t.Errorf("expected every product by ID, got %s (%v)", names(exported), err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.ExportProducts(ctx, repository.ProductFilter{}, nil, func(p models.Product) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected the export to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func testListSort(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	for _, p := range []models.Product{
+		{Name: "b", Price: usd("2")},
+		{Name: "a", Price: usd("2")},
+		{Name: "C", Price: usd("1")},
+		{Name: "d", Price: usd("3")},
+		{Name: "a", Price: usd("3")},
+	} {
+		mustInsert(t, repo, p)
+	}
+
+	tests := []struct {
+		sort     []repository.SortField
+		expected string
+	}{
+		{[]repository.SortField{{Field: repository.SortByName}}, "[C a a b d]"},
+		{[]repository.SortField{{Field: repository.SortByPrice}, {Field: repository.SortByName, Desc: true}}, "[C b a d a]"},
+		{[]repository.SortField{{Field: repository.SortByID, Desc: true}}, "[a d C a b]"},
+	}
+
+	for _, tt := range tests {
+		page, err := repo.ListProducts(ctx, repository.ListOptions{Sort: tt.sort})
+		if err != nil {
+			t.Fatalf("%v: unexpected list error: %v", tt.sort, err)
+		}
+		if got := names(page.Products); got != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.sort, tt.expected, got)
+		}
+
+		// walking the same order one product at a time must give the same result
+		var walked []models.Product
+		opts := repository.ListOptions{Limit: 1, Sort: tt.sort}
+		for i := 0; i < 10; i++ {
+			page, err := repo.ListProducts(ctx, opts)
+			if err != nil {
+				t.Fatalf("%v: unexpected list error: %v", tt.sort, err)
+			}
+			walked = append(walked, page.Products...)
+			if page.Next == nil {
+				break
+			}
+			opts.After = page.Next
+		}
+		if got := names(walked); got != tt.expected {
+			t.Errorf("%v: expected cursor walk %s, got %s", tt.sort, tt.expected, got)
+		}
+	}
+}
+
+func testSearch(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	juice := mustInsert(t, repo, models.Product{Name: "Orange Juice", Price: usd("3")})
+	mustInsert(t, repo, models.Product{Name: "Orange", Price: usd("1")})
+	mustInsert(t, repo, models.Product{Name: "Apple Juice", Price: usd("3")})
+	mustInsert(t, repo, models.Product{Name: "Grape", Price: usd("2")})
+
+	results, err := repo.SearchProducts(ctx, repository.SearchQuery{Text: "oran"})
+	if err != nil {
+		t.Fatalf("unexpected search error: %v", err)
+	}
+	if len(results) != 2 || results[0].Product.Name != "Orange" || results[1].Product.Name != "Orange Juice" {
+		t.Fatalf("expected the closer match Orange to rank first, got %+v", results)
+	}
+	if results[0].Rank <= results[1].Rank {
+		t.Errorf("expected decreasing ranks, got %v and %v", results[0].Rank, results[1].Rank)
+	}
+	if results[1].Snippet != "<mark>Orange</mark> Juice" {
+		t.Errorf("unexpected snippet %q", results[1].Snippet)
+	}
+
+	results, err = repo.SearchProducts(ctx, repository.SearchQuery{Text: "JUICE, or"})
+	if err != nil {
+		t.Fatalf("unexpected search error: %v", err)
+	}
+	if len(results) != 1 || results[0].Product.ID != juice {
+		t.Errorf("expected every word to match, got %+v", results)
+	}
+
+	results, err = repo.SearchProducts(ctx, repository.SearchQuery{Text: "juice", Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected search error: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected limit to be applied, got %d results", len(results))
+	}
+
+	results, err = repo.SearchProducts(ctx, repository.SearchQuery{Text: "banana"})
+	if err != nil || results == nil || len(results) != 0 {
+		t.Errorf("expected no results, got %v, %v", results, err)
+	}
+
+	if _, err := repo.SearchProducts(ctx, repository.SearchQuery{Text: " ?! "}); !errors.Is(err, repository.ErrValidation) {
+		t.Errorf("expected ErrValidation without search words, got %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	const missing = 999999
+
+	if _, err := repo.GetProductByID(ctx, missing); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetProductByID: expected ErrNotFound, got %v", err)
+	}
+	if err := repo.UpdateProductByID(ctx, missing, models.Product{Name: "x", Price: usd("1")}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateProductByID: expected ErrNotFound, got %v", err)
+	}
+	if err := repo.DeleteProductByID(ctx, missing); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("DeleteProductByID: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testConcurrentInserts(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	const writers = 20
+
+	ids := make(chan int64, writers)
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := repo.InsertProduct(context.Background(), models.Product{Name: fmt.Sprintf("Product %d", i), Price: usd("1")})
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected insert error: %v", err)
+	}
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %d was allocated twice", id)
+		}
+		seen[id] = true
+	}
+
+	page, err := repo.ListProducts(ctx, repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected list error: %v", err)
+	}
+	if len(page.Products) != writers || page.Total != writers {
+		t.Errorf("expected %d products, got %d (total %d)", writers, len(page.Products), page.Total)
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, repo repository.ProductRepository) {
+	ctx := context.Background()
+
+	const writers = 20
+
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("1")})
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := repo.UpdateProductByID(ctx, id, models.Product{Name: fmt.Sprintf("Product %d", i), Price: usd(fmt.Sprint(i + 1))}); err != nil {
+				t.Errorf("unexpected update error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := repo.GetProductByID(ctx, id)
+	if err != nil {
+		t.Fatalf("unexpected get error: %v", err)
+	}
+	// whichever write wins, name and price must come from the same one
+	if expected := fmt.Sprintf("Product %s", got.Price.Amount-usd("1").Amount); got.Name != expected {
+		t.Errorf("expected name %q for price %v, got %q", expected, got.Price, got.Name)
+	}
+}
+
+func testCanceledContext(t *testing.T, repo repository.ProductRepository) {
+	id := mustInsert(t, repo, models.Product{Name: "Product", Price: usd("1")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.InsertProduct(ctx, models.Product{Name: "x", Price: usd("1")}); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("InsertProduct: expected ErrUnavailable, got %v", err)
+	}
+	if _, err := repo.GetProductByID(ctx, id); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("GetProductByID: expected ErrUnavailable, got %v", err)
+	}
+	if err := repo.UpdateProductByID(ctx, id, models.Product{Name: "x", Price: usd("1")}); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("UpdateProductByID: expected ErrUnavailable, got %v", err)
+	}
+	if err := repo.DeleteProductByID(ctx, id); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("DeleteProductByID: expected ErrUnavailable, got %v", err)
+	}
+	if _, err := repo.ListProducts(ctx, repository.ListOptions{}); !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("ListProducts: expected ErrUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/bda-mota/MyFirstCRUD/myapp/models"
+)
+
+// SearchQuery looks for products whose name has a word starting with each of
+// the words of Text.
+type SearchQuery struct {
+	Text string
+	// Limit caps the number of results. Zero means no limit.
+	Limit int
+}
+
+// Matched words are delimited with control characters while the snippet is
+// built, then the snippet is HTML-escaped and the delimiters become <mark>
+// tags, so product names can never inject markup.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+var highlighter = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+func highlight(snippet string) string {
+	return highlighter.Replace(html.EscapeString(snippet))
+}
+
+// SearchTerms splits text into the lower-case words a search matches on,
+// the way the Postgres "simple" text search configuration does.
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isNotWordChar)
+}
+
+func isNotWordChar(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// prefixQuery turns terms into a tsquery matching words starting with every
+// term. Terms only hold letters and digits, so they need no quoting.
+func prefixQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// matchName is the in-memory counterpart of the tsvector search. It reports
+// whether every term prefixes a word of name, ranks the match by the share
+// of words matched and highlights them.
+func matchName(name string, terms []string) (models.SearchResult, bool) {
+	matchedTerms := make(map[string]bool)
+	var snippet strings.Builder
+	words, matchedWords := 0, 0
+
+	rest := name
+	for rest != "" {
+		start := strings.IndexFunc(rest, func(r rune) bool { return !isNotWordChar(r) })
+		if start < 0 {
+			snippet.WriteString(rest)
+			break
+		}
+		snippet.WriteString(rest[:start])
+		rest = rest[start:]
+
+		end := strings.IndexFunc(rest, isNotWordChar)
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+		words++
+
+		matched := false
+		for _, term := range terms {
+			if strings.HasPrefix(strings.ToLower(word), term) {
+				matchedTerms[term] = true
+				matched = true
+			}
+		}
+		if matched {
+			matchedWords++
+			snippet.WriteString(highlightStart + word + highlightStop)
+		} else {
+			snippet.WriteString(word)
+		}
+	}
+
+	for _, term := range terms {
+		if !matchedTerms[term] {
+			return models.SearchResult{}, false
+		}
+	}
+	return models.SearchResult{
+		Rank:    float64(matchedWords) / float64(words),
+		Snippet: highlight(snippet.String()),
+	}, true
+}
@@ -0,0 +1,49 @@
+package repository
+
+import "testing"
+
+func TestSearchTerms(t *testing.T) {
+	got := SearchTerms("  Café-Crème, 100% ")
+	expected := []string{"café", "crème", "100"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	if got := prefixQuery([]string{"orange", "ju"}); got != "orange:* & ju:*" {
+		t.Errorf("unexpected tsquery %q", got)
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	res, ok := matchName("Fresh orange-juice (1L)", []string{"jui", "fr"})
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if res.Snippet != "<mark>Fresh</mark> orange-<mark>juice</mark> (1L)" {
+		t.Errorf("unexpected snippet %q", res.Snippet)
+	}
+	if res.Rank != 0.5 {
+		t.Errorf("expected rank 0.5, got %v", res.Rank)
+	}
+
+	if _, ok := matchName("Fresh orange juice", []string{"fresh", "apple"}); ok {
+		t.Error("expected no match when a term is missing")
+	}
+}
+
+func TestMatchName_EscapesHTML(t *testing.T) {
+	res, ok := matchName("<b>Bold</b> & co", []string{"bold"})
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if res.Snippet != "&lt;b&gt;<mark>Bold</mark>&lt;/b&gt; &amp; co" {
+		t.Errorf("unexpected snippet %q", res.Snippet)
+	}
+}
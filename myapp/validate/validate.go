@@ -0,0 +1,235 @@
+// Package validate checks structs against the rules declared in their
+// `validate` field tags, and reports every invalid field at once.
+//
+// The rules of a field are separated by commas and checked in order; the
+// first one failing is the error of the field:
+//
+//	required   the field is not the zero value
+//	notblank   a string has a character other than white space
+//	min=N      a string has at least N characters, a number is at least N
+//	max=N      a string has at most N characters, a number is at most N
+//	pattern=RE a string matches the regular expression RE
+//
+// Zero values pass every rule but required, so optional fields are only
+// checked when set. pattern takes the rest of the tag, so it must be the last
+// rule. Rules that involve several fields are written as a Check method, see
+// Checker.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Error is an invalid field. Field is a JSON Pointer to the value, such as
+// /price/amount.
+type Error struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Errors lists the invalid fields of a value, in field order.
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Checker is implemented by structs with rules a tag cannot express. Check
+// runs after the tag rules and returns the invalid fields, nil when there are
+// none.
+type Checker interface {
+	Check() Errors
+}
+
+// Struct checks v, a struct or a pointer to one, and returns its Errors or
+// nil. It panics if a tag of v is invalid.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	var errs Errors
+	for _, f := range fieldsOf(value.Type()) {
+		if err := f.check(value.Field(f.index)); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+	if c, ok := v.(Checker); ok {
+		errs = append(errs, c.Check()...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// field is a struct field with rules.
+type field struct {
+	index   int
+	pointer string
+	label   string
+	rules   []rule
+}
+
+// rule checks a value and returns the code and message of its error, or an
+// empty code.
+type rule func(v reflect.Value, label string) (code, message string)
+
+func (f field) check(v reflect.Value) *Error {
+	for _, r := range f.rules {
+		if code, message := r(v, f.label); code != "" {
+			return &Error{Field: f.pointer, Code: code, Message: message}
+		}
+	}
+	return nil
+}
+
+// fields caches the fields with rules of each struct type.
+var fields sync.Map
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fields.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var parsed []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		rules, err := parseRules(sf.Type, tag)
+		if err != nil {
+			panic(fmt.Sprintf("validate: field %s.%s: %v", t.Name(), sf.Name, err))
+		}
+		parsed = append(parsed, field{index: i, pointer: "/" + jsonName(sf), label: sf.Name, rules: rules})
+	}
+	fields.Store(t, parsed)
+	return parsed
+}
+
+// jsonName returns the name of the field in JSON documents.
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func parseRules(t reflect.Type, tag string) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		var spec string
+		if strings.HasPrefix(tag, "pattern=") {
+			spec, tag = tag, ""
+		} else {
+			spec, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, _ := strings.Cut(spec, "=")
+
+		var r rule
+		var err error
+		switch name {
+		case "required":
+			r = required
+		case "notblank":
+			if t.Kind() != reflect.String {
+				err = fmt.Errorf("notblank does not apply to %s", t)
+			}
+			r = notBlank
+		case "min", "max":
+			r, err = bound(t, name, param)
+		case "pattern":
+			r, err = pattern(t, param)
+		default:
+			err = fmt.Errorf("unknown rule %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func required(v reflect.Value, label string) (string, string) {
+	if v.IsZero() {
+		return "required", label + " is required"
+	}
+	return "", ""
+}
+
+func notBlank(v reflect.Value, label string) (string, string) {
+	if !v.IsZero() && strings.TrimSpace(v.String()) == "" {
+		return "blank", label + " must not be blank"
+	}
+	return "", ""
+}
+
+// bound returns the min or max rule. Zero values pass it, so that optional
+// fields are only checked when set.
+func bound(t reflect.Type, name, param string) (rule, error) {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs an integer, got %q", name, param)
+	}
+	min := name == "min"
+
+	switch t.Kind() {
+	case reflect.String:
+		return func(v reflect.Value, label string) (string, string) {
+			if v.IsZero() {
+				return "", ""
+			}
+			length := int64(utf8.RuneCountInString(v.String()))
+			switch {
+			case min && length < n:
+				return "too_short", fmt.Sprintf("%s must be at least %d characters", label, n)
+			case !min && length > n:
+				return "too_long", fmt.Sprintf("%s must be at most %d characters", label, n)
+			}
+			return "", ""
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value, label string) (string, string) {
+			if v.IsZero() {
+				return "", ""
+			}
+			switch {
+			case min && v.Int() < n:
+				return "too_small", fmt.Sprintf("%s must be at least %d", label, n)
+			case !min && v.Int() > n:
+				return "too_large", fmt.Sprintf("%s must be at most %d", label, n)
+			}
+			return "", ""
+		}, nil
+	}
+	return nil, fmt.Errorf("%s does not apply to %s", name, t)
+}
+
+// pattern returns the pattern rule. Like the bounds, it passes empty strings.
+func pattern(t reflect.Type, param string) (rule, error) {
+	if t.Kind() != reflect.String {
+		return nil, fmt.Errorf("pattern does not apply to %s", t)
+	}
+	re, err := regexp.Compile(param)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value, label string) (string, string) {
+		if !v.IsZero() && !re.MatchString(v.String()) {
+			return "invalid_format", label + " is not in the expected format"
+		}
+		return "", ""
+	}, nil
+}
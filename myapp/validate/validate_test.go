@@ -0,0 +1,91 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Code  string `json:"code,omitempty" validate:"required,min=2,max=4,pattern=^[A-Z]+$"`
+	Count int    `json:"count" validate:"min=1,max=10"`
+	Note  string `validate:"notblank,max=3"`
+	Skip  string `json:"skip"`
+	Tag   string `json:"tag" validate:"pattern=^[a-z]+$"`
+}
+
+type pair struct {
+	Low  int `json:"low"`
+	High int `json:"high"`
+}
+
+func (p pair) Check() Errors {
+	if p.Low > p.High {
+		return Errors{{Field: "/low", Code: "above_high", Message: "Low must not exceed High"}}
+	}
+	return nil
+}
+
+func TestStruct(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"Valid", item{Code: "AB", Count: 3}, "[]"},
+		{"ValidPointer", &item{Code: "ABCD", Count: 10, Note: "é€$"}, "[]"},
+		{"Required", item{Count: 3}, "[{/code required Code is required}]"},
+		{"TooShort", item{Code: "A", Count: 3}, "[{/code too_short Code must be at least 2 characters}]"},
+		{"Pattern", item{Code: "ab", Count: 3}, "[{/code invalid_format Code is not in the expected format}]"},
+		{"All", item{Code: "ABCDE", Count: 11, Note: "long", Skip: "x"},
+			"[{/code too_long Code must be at most 4 characters} {/count too_large Count must be at most 10} {/Note too_long Note must be at most 3 characters}]"},
+		{"OptionalBound", item{Code: "AB"}, "[]"},
+		{"Blank", item{Code: "AB", Count: 1, Note: " \t "}, "[{/Note blank Note must not be blank}]"},
+		{"OptionalPattern", item{Code: "AB", Tag: "A"}, "[{/tag invalid_format Tag is not in the expected format}]"},
+		{"Check", pair{Low: 2, High: 1}, "[{/low above_high Low must not exceed High}]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs Errors
+			err := Struct(tc.value)
+			if err != nil && !errors.As(err, &errs) {
+				t.Fatalf("expected Errors, got %T", err)
+			}
+			if got := stringify(errs); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestStruct_NegativeBound(t *testing.T) {
+	err := Struct(item{Code: "AB", Count: -1})
+	if err == nil || err.Error() != "Count must be at least 1" {
+		t.Errorf("expected the min error, got %v", err)
+	}
+}
+
+func TestErrors_Error(t *testing.T) {
+	errs := Errors{{Message: "Name is required"}, {Message: "Price is required"}}
+	if got := errs.Error(); got != "Name is required; Price is required" {
+		t.Errorf("unexpected message %q", got)
+	}
+}
+
+func TestStruct_InvalidTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	Struct(struct {
+		Flag bool `validate:"min=1"`
+	}{})
+}
+
+func stringify(errs Errors) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = "{" + e.Field + " " + e.Code + " " + e.Message + "}"
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}